@@ -2,9 +2,12 @@ package api
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
 )
 
 func (a *API) Audio(c echo.Context) error {
@@ -16,11 +19,17 @@ func (a *API) Audio(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'start'")
 	}
 
+	formats := a.library.Formats(stationID, startTime)
+	if len(formats) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "recording not found")
+	}
 	if len(format) == 0 {
-		format = "m3u8"
+		format = formats[0]
+	}
+	if !contains(formats, format) {
+		return echo.NewHTTPError(http.StatusNotFound, "No such format. Available formats are "+strings.Join(formats, "/")+": format="+format)
 	}
-	switch format {
-	case "m3u8":
+	if format == library.FormatM3U8 {
 		buf := new(bytes.Buffer)
 		if err := a.library.GenerateM3U8(a.baseURL, stationID, startTime, buf); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate m3u8")
@@ -28,10 +37,26 @@ func (a *API) Audio(c echo.Context) error {
 		header := c.Response().Header()
 		header.Add("Content-Type", "application/x-mpegURL")
 		return c.String(200, buf.String())
-	case "mp3":
-		return c.File(a.library.MP3(stationID, startTime))
-	case "aac":
-		return c.File(a.library.AAC(stationID, startTime))
 	}
-	return echo.NewHTTPError(http.StatusBadRequest, "No such format. Supported format are m3u8/mp3/aac: format="+format)
+	file, err := a.library.AudioFile(stationID, startTime, format)
+	if err != nil {
+		if errors.Is(err, library.ErrFormatNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "file not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to produce the audio file")
+	}
+	title := ""
+	if detail, err := a.library.Get(stationID, startTime); err == nil {
+		title = detail.Title
+	}
+	return serveFile(c, file, contentTypes[format], stationID+"-"+start+"-"+format, downloadName(title, startTime, format))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
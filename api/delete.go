@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+func (a *API) Delete(c echo.Context) error {
+	stationID := c.Param("stationID")
+	start := c.Param("start")
+	startTime, err := a.library.ParseTime(start)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'start'")
+	}
+	if err := a.library.Delete(stationID, startTime); err != nil {
+		switch {
+		case errors.Is(err, library.ErrInvalidStation):
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid 'stationID'")
+		case errors.Is(err, library.ErrRecordingNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "recording not found")
+		case errors.Is(err, library.ErrRecordingBusy):
+			return echo.NewHTTPError(http.StatusConflict, "recording job is running.  cancel the job first")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete recording")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
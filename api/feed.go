@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+const maxFeedItems = 100
+
+type (
+	rss struct {
+		XMLName   xml.Name   `xml:"rss"`
+		Version   string     `xml:"version,attr"`
+		ITunesNS  string     `xml:"xmlns:itunes,attr"`
+		ContentNS string     `xml:"xmlns:content,attr"`
+		Channel   rssChannel `xml:"channel"`
+	}
+	rssChannel struct {
+		Title          string    `xml:"title"`
+		Link           string    `xml:"link"`
+		Description    string    `xml:"description"`
+		Language       string    `xml:"language"`
+		ITunesAuthor   string    `xml:"itunes:author"`
+		ITunesSummary  string    `xml:"itunes:summary"`
+		ITunesExplicit string    `xml:"itunes:explicit"`
+		Items          []rssItem `xml:"item"`
+	}
+	rssItem struct {
+		Title          string       `xml:"title"`
+		Description    string       `xml:"description"`
+		PubDate        string       `xml:"pubDate"`
+		GUID           rssGUID      `xml:"guid"`
+		Link           string       `xml:"link,omitempty"`
+		Enclosure      rssEnclosure `xml:"enclosure"`
+		ITunesSubtitle string       `xml:"itunes:subtitle,omitempty"`
+		ITunesSummary  string       `xml:"itunes:summary,omitempty"`
+		ITunesDuration string       `xml:"itunes:duration"`
+		ITunesAuthor   string       `xml:"itunes:author"`
+	}
+	rssGUID struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+	rssEnclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	}
+)
+
+// KeywordFeed renders the podcast feed of the recordings matched by the keyword rule.
+func (a *API) KeywordFeed(c echo.Context) error {
+	rule, err := a.library.Keyword(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, library.ErrKeywordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "keyword not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keyword")
+	}
+	return a.feed(c, rule.Keyword, fmt.Sprintf("Recordings of the keyword '%s'", rule.Keyword), func(r library.Recording) bool {
+		return r.RuleID == rule.ID
+	})
+}
+
+// StationFeed renders the podcast feed of the recordings of the station.
+func (a *API) StationFeed(c echo.Context) error {
+	stationID := c.Param("stationID")
+	return a.feed(c, stationID, fmt.Sprintf("Recordings of the station '%s'", stationID), func(r library.Recording) bool {
+		return r.StationID == stationID
+	})
+}
+
+func (a *API) feed(c echo.Context, title string, description string, filter func(library.Recording) bool) error {
+	recordings, err := a.library.List()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get the list of recording files")
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Start.After(recordings[j].Start)
+	})
+
+	items := make([]rssItem, 0)
+	for _, recording := range recordings {
+		if len(items) >= maxFeedItems {
+			break
+		}
+		if !filter(recording) {
+			continue
+		}
+		item, ok := a.feedItem(recording)
+		if !ok {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	feed := rss{
+		Version:   "2.0",
+		ITunesNS:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel: rssChannel{
+			Title:          title,
+			Link:           a.baseURL,
+			Description:    description,
+			Language:       "ja",
+			ITunesAuthor:   "radiko-server",
+			ITunesSummary:  description,
+			ITunesExplicit: "false",
+			Items:          items,
+		},
+	}
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to render feed")
+	}
+	return c.Blob(http.StatusOK, "application/rss+xml; charset=UTF-8", append([]byte(xml.Header), b...))
+}
+
+// feedItem returns the feed item of the recording.
+// It returns false if the recording is not ready to listen.
+func (a *API) feedItem(recording library.Recording) (rssItem, bool) {
+	status, err := a.library.GetStatus(recording.StationID, recording.Start)
+	if err != nil || status.Status != library.StatusReady {
+		return rssItem{}, false
+	}
+	detail, err := a.library.Get(recording.StationID, recording.Start)
+	if err != nil {
+		return rssItem{}, false
+	}
+
+	enclosure, ok := a.enclosure(recording)
+	if !ok {
+		return rssItem{}, false
+	}
+
+	author := detail.Performer
+	if len(author) == 0 {
+		author = detail.StationName
+	}
+	if len(author) == 0 {
+		author = recording.StationID
+	}
+	start := a.library.FormatTime(recording.Start)
+	return rssItem{
+		Title:       fmt.Sprintf("%s (%s)", detail.Title, recording.Start.Format("2006/01/02")),
+		Description: detail.Description,
+		PubDate:     recording.Start.Format(time.RFC1123Z),
+		GUID: rssGUID{
+			IsPermaLink: false,
+			Value:       recording.StationID + "/" + start,
+		},
+		Link:           detail.URL,
+		Enclosure:      enclosure,
+		ITunesSubtitle: detail.Subtitle,
+		ITunesSummary:  detail.Description,
+		ITunesDuration: formatDuration(recording.End.Sub(recording.Start)),
+		ITunesAuthor:   author,
+	}, true
+}
+
+var enclosureFormats = []struct {
+	format      string
+	contentType string
+}{
+	// mp3 is the most compatible format for the podcast apps
+	{library.FormatMP3, "audio/mpeg"},
+	{library.FormatM4A, "audio/mp4"},
+}
+
+// enclosure returns the enclosure of the recording with the file size.
+// Only the produced formats are listed because the podcast apps rely on the length of the enclosure.
+// The library produces m4a after the recording if it has no mp3.
+func (a *API) enclosure(recording library.Recording) (rssEnclosure, bool) {
+	for _, f := range enclosureFormats {
+		if size := a.library.AudioFileSize(recording.StationID, recording.Start, f.format); size > 0 {
+			return rssEnclosure{
+				URL:    a.audioURL(recording.StationID, recording.Start, f.format),
+				Length: size,
+				Type:   f.contentType,
+			}, true
+		}
+	}
+	return rssEnclosure{}, false
+}
+
+func (a *API) audioURL(stationID string, start time.Time, format string) string {
+	return fmt.Sprintf("%srecordings/recording/%s/%s/audio?format=%s", a.baseURL, stationID, a.library.FormatTime(start), format)
+}
+
+// formatDuration formats the duration in HH:MM:SS.
+func formatDuration(d time.Duration) string {
+	s := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
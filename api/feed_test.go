@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+// stationFeed renders the feed of TBS.
+func stationFeed(t *testing.T, l *library.Library) *rss {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("stationID")
+	c.SetParamValues("TBS")
+	if err := New(l, "http://localhost:8080/").StationFeed(c); err != nil {
+		t.Fatal(err)
+	}
+	var feed rss
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	return &feed
+}
+
+func TestFeedEnclosureLength(t *testing.T) {
+	// m4a is produced after the recording without mp3
+	profile := library.DefaultOutputProfile()
+	profile.MP3 = false
+	l, start := newRecordedLibrary(t, profile)
+
+	feed := stationFeed(t, l)
+	if len(feed.Channel.Items) != 1 {
+		t.Fatalf("items = %d, want 1", len(feed.Channel.Items))
+	}
+	enclosure := feed.Channel.Items[0].Enclosure
+	if enclosure.Type != "audio/mp4" {
+		t.Errorf("enclosure type = %q", enclosure.Type)
+	}
+	if want := l.AudioFileSize("TBS", start, library.FormatM4A); want == 0 || enclosure.Length != want {
+		t.Errorf("enclosure length = %d, want %d", enclosure.Length, want)
+	}
+
+	// the feed doesn't produce the audio files
+	m4a, err := l.AudioFile("TBS", start, library.FormatM4A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(m4a); err != nil {
+		t.Fatal(err)
+	}
+	if feed := stationFeed(t, l); len(feed.Channel.Items) != 0 {
+		t.Errorf("items = %d without the produced files, want 0", len(feed.Channel.Items))
+	}
+	if _, err := os.Stat(m4a); !os.IsNotExist(err) {
+		t.Errorf("m4a is produced by the feed: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
 )
 
 func (a *API) File(c echo.Context) error {
@@ -19,5 +20,7 @@ func (a *API) File(c echo.Context) error {
 	if _, err := os.Stat(f); os.IsNotExist(err) {
 		return echo.NewHTTPError(http.StatusNotFound, "file not found")
 	}
-	return c.File(f)
+	// chunk files are never modified after downloaded
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return serveFile(c, f, contentTypes[library.FormatAAC], stationID+"-"+start+"-"+file, "")
 }
@@ -10,6 +10,7 @@ import (
 type GetResponse struct {
 	Status    *library.Status          `json:"status"`
 	Recording *library.RecordingDetail `json:"recording"`
+	Formats   []string                 `json:"formats"`
 }
 
 func (a *API) Get(c echo.Context) error {
@@ -30,5 +31,6 @@ func (a *API) Get(c echo.Context) error {
 	return c.JSON(http.StatusOK, GetResponse{
 		Status:    status,
 		Recording: recording,
+		Formats:   a.library.Formats(stationID, startTime),
 	})
 }
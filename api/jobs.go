@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+type JobResponse struct {
+	library.Job
+	Status *library.Status `json:"status,omitempty"`
+}
+
+func (a *API) Jobs(c echo.Context) error {
+	jobs, err := a.library.Jobs()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get the list of jobs")
+	}
+	state := c.QueryParam("state")
+	resp := make([]JobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		if len(state) > 0 && job.State != state {
+			continue
+		}
+		resp = append(resp, a.jobResponse(&job))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (a *API) Job(c echo.Context) error {
+	job, err := a.library.Job(c.Param("id"))
+	if err != nil {
+		return jobError(err)
+	}
+	return c.JSON(http.StatusOK, a.jobResponse(job))
+}
+
+func (a *API) CancelJob(c echo.Context) error {
+	job, err := a.library.CancelJob(c.Param("id"))
+	if err != nil {
+		return jobError(err)
+	}
+	return c.JSON(http.StatusAccepted, a.jobResponse(job))
+}
+
+func (a *API) RetryJob(c echo.Context) error {
+	job, err := a.library.RetryJob(c.Param("id"))
+	if err != nil {
+		return jobError(err)
+	}
+	return c.JSON(http.StatusAccepted, a.jobResponse(job))
+}
+
+func (a *API) jobResponse(job *library.Job) JobResponse {
+	// status is not available until the job starts
+	status, _ := a.library.GetStatus(job.StationID, job.Start)
+	return JobResponse{*job, status}
+}
+
+func jobError(err error) error {
+	switch {
+	case errors.Is(err, library.ErrJobNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "job not found")
+	case errors.Is(err, library.ErrJobNotCancelable), errors.Is(err, library.ErrJobNotRetryable):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "failed to process the job")
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+func (a *API) Keywords(c echo.Context) error {
+	keywords, err := a.library.Keywords()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keywords")
+	}
+	return c.JSON(http.StatusOK, keywords)
+}
+
+func (a *API) RegisterKeyword(c echo.Context) error {
+	var req library.KeywordRule
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	rule, err := a.library.RegisterKeyword(req)
+	if err != nil {
+		if errors.Is(err, library.ErrInvalidKeyword) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to register keyword")
+	}
+	return c.JSON(http.StatusCreated, rule)
+}
+
+func (a *API) UpdateKeyword(c echo.Context) error {
+	var req library.KeywordRule
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	req.ID = c.Param("id")
+	if err := a.library.UpdateKeyword(req); err != nil {
+		if errors.Is(err, library.ErrInvalidKeyword) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, library.ErrKeywordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "keyword not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update keyword")
+	}
+	// the stored rule is normalized by the validation
+	rule, err := a.library.Keyword(req.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get keyword")
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+func (a *API) UnregisterKeyword(c echo.Context) error {
+	if err := a.library.UnregisterKeyword(c.Param("id")); err != nil {
+		if errors.Is(err, library.ErrKeywordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "keyword not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to unregister keyword")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PreviewKeywords returns the programs in the weekly guide matched by the keyword rules.
+func (a *API) PreviewKeywords(c echo.Context) error {
+	preview, err := a.library.PreviewKeywords("")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to preview keywords")
+	}
+	return c.JSON(http.StatusOK, preview)
+}
+
+// PreviewKeyword returns the programs in the weekly guide matched by the keyword rule.
+func (a *API) PreviewKeyword(c echo.Context) error {
+	preview, err := a.library.PreviewKeywords(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, library.ErrKeywordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "keyword not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to preview keyword")
+	}
+	return c.JSON(http.StatusOK, preview)
+}
@@ -1,15 +1,71 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
 )
 
+const maxListLimit = 1000
+
+// List lists the recordings.
+//
+// Query parameters:
+//
+//	q: space separated terms searched from title, subtitle, description and performer
+//	station: station ID
+//	keyword: keyword rule ID
+//	from, to: range of the program start (20060102 or 20060102150405)
+//	status: recording status. e.g. READY
+//	sort: start, -start (default), title or -title
+//	limit, cursor: pagination.  The cursor of the next page is returned in the X-Next-Cursor header.
 func (a *API) List(c echo.Context) error {
-	recordings, err := a.library.List()
+	q := library.Query{
+		Text:      c.QueryParam("q"),
+		StationID: c.QueryParam("station"),
+		RuleID:    c.QueryParam("keyword"),
+		Status:    c.QueryParam("status"),
+		Sort:      c.QueryParam("sort"),
+		Cursor:    c.QueryParam("cursor"),
+	}
+	var err error
+	if q.From, err = a.parseDate(c.QueryParam("from")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'from'")
+	}
+	if q.To, err = a.parseDate(c.QueryParam("to")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'to'")
+	}
+	if limit := c.QueryParam("limit"); len(limit) > 0 {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit <= 0 || q.Limit > maxListLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid 'limit'")
+		}
+	}
+
+	page, err := a.library.Search(q)
 	if err != nil {
+		if errors.Is(err, library.ErrInvalidQuery) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get the list of recording files")
 	}
-	return c.JSON(http.StatusOK, recordings)
+	if len(page.NextCursor) > 0 {
+		c.Response().Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	return c.JSON(http.StatusOK, page.Recordings)
+}
+
+// parseDate parses the date in 20060102 or 20060102150405 format.  Empty string is the zero time.
+func (a *API) parseDate(s string) (time.Time, error) {
+	switch len(s) {
+	case 0:
+		return time.Time{}, nil
+	case len("20060102"):
+		return a.library.ParseTime(s + "000000")
+	}
+	return a.library.ParseTime(s)
 }
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+func (a *API) Pin(c echo.Context) error {
+	return a.pin(c, true)
+}
+
+func (a *API) Unpin(c echo.Context) error {
+	return a.pin(c, false)
+}
+
+func (a *API) pin(c echo.Context, pinned bool) error {
+	stationID := c.Param("stationID")
+	start := c.Param("start")
+	startTime, err := a.library.ParseTime(start)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'start'")
+	}
+	if err := a.library.Pin(stationID, startTime, pinned); err != nil {
+		if errors.Is(err, library.ErrRecordingNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "recording not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update recording")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
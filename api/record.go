@@ -1,30 +1,80 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo"
-	"github.com/labstack/gommon/log"
+	"github.com/uphy/radiko-server/library"
 )
 
-type RecordRequest struct {
-	StationID string `json:"stationId"`
-	Start     string `json:"start"`
-}
+type (
+	// RecordRequest specifies the program by the station and the start time, or by the radiko.jp URL.
+	// Live schedules the recording of the live stream at the program start instead of the timeshift download.
+	RecordRequest struct {
+		StationID string `json:"stationId"`
+		Start     string `json:"start"`
+		URL       string `json:"url,omitempty"`
+		Live      bool   `json:"live,omitempty"`
+	}
+
+	// ValidationError is the response for the invalid request field.
+	ValidationError struct {
+		Field     string   `json:"field"`
+		Message   string   `json:"message"`
+		Value     string   `json:"value,omitempty"`
+		Supported []string `json:"supported,omitempty"`
+	}
+)
 
 func (a *API) Record(c echo.Context) error {
 	var req RecordRequest
 	if err := c.Bind(&req); err != nil {
 		return err
 	}
-	start, err := a.library.ParseTime(req.Start)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'start'")
+	stationID := req.StationID
+	var start time.Time
+	if len(req.URL) > 0 {
+		var err error
+		stationID, start, err = a.library.ParseProgramURL(req.URL)
+		if err != nil {
+			var urlErr *library.URLError
+			if errors.As(err, &urlErr) {
+				return echo.NewHTTPError(http.StatusBadRequest, &ValidationError{
+					Field:     "url",
+					Message:   urlErr.Reason,
+					Value:     req.URL,
+					Supported: library.SupportedURLFormats,
+				})
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to parse 'url'")
+		}
+	} else {
+		if len(stationID) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "'stationId' and 'start', or 'url' is required")
+		}
+		var err error
+		start, err = a.library.ParseTime(req.Start)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid 'start'")
+		}
+	}
+	var job *library.Job
+	var err error
+	if req.Live {
+		job, err = a.library.EnqueueLive(stationID, start)
+	} else {
+		job, err = a.library.Enqueue(stationID, start)
 	}
-	go func() {
-		if err := a.library.Record(req.StationID, start); err != nil {
-			log.Errorf("Failed to record %s", err.Error())
+	if err != nil {
+		if errors.Is(err, library.ErrInvalidStation) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid 'stationId'")
+		}
+		if errors.Is(err, library.ErrStationOutOfArea) {
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
 		}
-	}()
-	return c.NoContent(http.StatusAccepted)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to enqueue the recording")
+	}
+	return c.JSON(http.StatusAccepted, job)
 }
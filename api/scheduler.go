@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// Scheduler returns the state of the scheduler and the planned recordings.
+func (a *API) Scheduler(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.library.SchedulerStatus())
+}
+
+// ScanReport returns the report of the last scan.
+func (a *API) ScanReport(c echo.Context) error {
+	report := a.library.LastScanReport()
+	if report == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "programs have not been scanned yet")
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Scan scans the programs immediately and returns the report.
+// The errors of the stations and the programs are included in the report.
+func (a *API) Scan(c echo.Context) error {
+	report, err := a.library.ScanAndRecord()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
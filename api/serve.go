@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+var contentTypes = map[string]string{
+	library.FormatAAC:  "audio/aac",
+	library.FormatM4A:  "audio/mp4",
+	library.FormatMP3:  "audio/mpeg",
+	library.FormatOpus: "audio/ogg; codecs=opus",
+	library.FormatFLAC: "audio/flac",
+}
+
+// serveFile serves the file supporting Range requests and conditional GET.
+// Empty downloadName omits the Content-Disposition header.
+func serveFile(c echo.Context, file string, contentType string, etagPrefix string, downloadName string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set("Accept-Ranges", "bytes")
+	// the file is rewritten by tagging, so the size and the modification time are included
+	header.Set("ETag", fmt.Sprintf(`"%s-%x-%x"`, etagPrefix, info.Size(), info.ModTime().UnixNano()))
+	if len(downloadName) > 0 {
+		header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": downloadName}))
+	}
+	http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// downloadName returns the file name built from the program title and date.
+func downloadName(title string, start time.Time, format string) string {
+	title = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if len(title) == 0 {
+		title = "recording"
+	}
+	return fmt.Sprintf("%s_%s.%s", title, start.Format("20060102"), format)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+	"github.com/uphy/radiko-server/library/librarytest"
+)
+
+func TestMain(m *testing.M) {
+	librarytest.Main(m)
+}
+
+// serve serves the file with the request built by the given function.
+func serve(t *testing.T, file string, downloadName string, build func(r *http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if build != nil {
+		build(req)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if err := serveFile(c, file, contentTypes[library.FormatMP3], "TBS-20201231230000-mp3", downloadName); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "all.mp3")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestServeFileRange(t *testing.T) {
+	file := writeFile(t, "0123456789")
+	rec := serve(t, file, "", func(r *http.Request) {
+		r.Header.Set("Range", "bytes=2-5")
+	})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusPartialContent)
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got := rec.Body.String(); got != "2345" {
+		t.Errorf("body = %q", got)
+	}
+	if got := rec.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q", got)
+	}
+}
+
+func TestServeFileNotModified(t *testing.T) {
+	file := writeFile(t, "0123456789")
+	rec := serve(t, file, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	etag := rec.Header().Get("ETag")
+	lastModified := rec.Header().Get("Last-Modified")
+	if len(etag) == 0 || len(lastModified) == 0 {
+		t.Fatalf("ETag = %q, Last-Modified = %q", etag, lastModified)
+	}
+
+	if rec := serve(t, file, "", func(r *http.Request) {
+		r.Header.Set("If-None-Match", etag)
+	}); rec.Code != http.StatusNotModified {
+		t.Errorf("status with If-None-Match = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec := serve(t, file, "", func(r *http.Request) {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}); rec.Code != http.StatusNotModified {
+		t.Errorf("status with If-Modified-Since = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	// the file rewritten by tagging has another ETag
+	if err := ioutil.WriteFile(file, []byte("01234567890"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(t, file, "", func(r *http.Request) {
+		r.Header.Set("If-None-Match", etag)
+	}); rec.Code != http.StatusOK {
+		t.Errorf("status with the stale ETag = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestServeFileContentDisposition(t *testing.T) {
+	file := writeFile(t, "0123456789")
+	name := downloadName("荻上チキ・Session/金曜", time.Date(2020, 12, 31, 22, 0, 0, 0, time.UTC), library.FormatMP3)
+	rec := serve(t, file, name, nil)
+
+	disposition := rec.Header().Get(echo.HeaderContentDisposition)
+	mediaType, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		t.Fatalf("invalid Content-Disposition %q: %v", disposition, err)
+	}
+	if mediaType != "inline" {
+		t.Errorf("disposition type = %q", mediaType)
+	}
+	if want := "荻上チキ・Session_金曜_20201231.mp3"; params["filename"] != want {
+		t.Errorf("filename = %q, want %q", params["filename"], want)
+	}
+	// the non-ASCII file name is encoded as defined by RFC 2231
+	if !strings.HasPrefix(disposition, "inline; filename*=utf-8''") {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	if rec := serve(t, file, "", nil); len(rec.Header().Get(echo.HeaderContentDisposition)) > 0 {
+		t.Errorf("Content-Disposition is set without the download name")
+	}
+}
+
+// newRecordedLibrary returns the library with the recorded program of TBS and its start time.
+func newRecordedLibrary(t *testing.T, profile library.OutputProfile) (*library.Library, time.Time) {
+	t.Helper()
+	l, source := librarytest.NewLibrary(t)
+	if err := l.SetOutputProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "荻上チキ・Session", 2)
+	if job := librarytest.Record(t, l, start); job.State != library.JobSucceeded {
+		t.Fatalf("job state = %s, error = %s", job.State, job.Error)
+	}
+	return l, start
+}
+
+func TestAudioContentType(t *testing.T) {
+	l, start := newRecordedLibrary(t, library.DefaultOutputProfile())
+
+	a := New(l, "http://localhost:8080/")
+	e := echo.New()
+	for _, tt := range []struct {
+		format, contentType string
+	}{
+		{library.FormatAAC, "audio/aac"},
+		{library.FormatM4A, "audio/mp4"},
+		{library.FormatMP3, "audio/mpeg"},
+		{library.FormatM3U8, "application/x-mpegURL"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/?format="+tt.format, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("stationID", "start")
+		c.SetParamValues("TBS", start.Format(library.DatetimeLayout))
+		if err := a.Audio(c); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d", tt.format, rec.Code)
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); got != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.format, got, tt.contentType)
+		}
+	}
+}
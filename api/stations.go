@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/uphy/radiko-server/library"
+)
+
+// Stations returns the stations of the detected and the configured areas.  'area' (e.g. JP27) lists the stations of the area.
+func (a *API) Stations(c echo.Context) error {
+	stations, err := a.library.Stations(c.QueryParam("area"))
+	if err != nil {
+		if errors.Is(err, library.ErrInvalidArea) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid 'area'")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get stations")
+	}
+	return c.JSON(http.StatusOK, stations)
+}
+
+// Area returns the area detected from the IP address and the areas whose guides are scanned.
+func (a *API) Area(c echo.Context) error {
+	area, err := a.library.Area()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to detect area")
+	}
+	return c.JSON(http.StatusOK, area)
+}
+
+// Programs returns the weekly programs of the station.  'date' (20060102) restricts them to the broadcast day.
+func (a *API) Programs(c echo.Context) error {
+	date, err := a.parseDate(c.QueryParam("date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid 'date'")
+	}
+	programs, err := a.library.Programs(c.Param("id"), date)
+	if err != nil {
+		if errors.Is(err, library.ErrStationNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "station not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get programs")
+	}
+	return c.JSON(http.StatusOK, programs)
+}
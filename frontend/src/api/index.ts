@@ -13,6 +13,11 @@ export interface RecordingDetail extends Recording {
   subtitle: string;
   url: string;
   info: string;
+  performer?: string;
+  image?: string;
+  genre?: string;
+  stationName?: string;
+  stationLogo?: string;
 }
 
 export interface RecordingDetailResponse {
@@ -44,6 +49,11 @@ class Api {
       start,
     });
   }
+  async recordURL(url: string): Promise<void> {
+    a.post("recordings/record", {
+      url,
+    });
+  }
   async getRecording(stationId: string, start: string): Promise<RecordingDetailResponse | null> {
     const data = (await a.get(`recordings/recording/${stationId}/${start}`))
       .data;
@@ -0,0 +1,137 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yyoshiki41/go-radiko"
+)
+
+var (
+	ErrInvalidArea = errors.New("invalid area")
+	// ErrStationOutOfArea is returned when the station is not in the area detected from the IP address.
+	// radiko serves the playlists of the stations only in the area.
+	ErrStationOutOfArea = errors.New("station is outside the reachable area")
+)
+
+// areaIDPattern matches the area IDs of the prefectures, JP1 (Hokkaido) to JP47 (Okinawa).
+var areaIDPattern = regexp.MustCompile(`^JP([1-9]|[1-3][0-9]|4[0-7])$`)
+
+type (
+	// AreaStatus is the area detected from the IP address and the areas whose guides are scanned.
+	AreaStatus struct {
+		Detected string `json:"detected"`
+		// Areas has the detected area and the configured areas.
+		Areas []string `json:"areas"`
+	}
+
+	// areaStation is the station and the areas it is available in.
+	areaStation struct {
+		radiko.Station
+		areas []string
+	}
+)
+
+func validateArea(areaID string) error {
+	if !areaIDPattern.MatchString(areaID) {
+		return fmt.Errorf("%w: must be JP1 to JP47: %s", ErrInvalidArea, areaID)
+	}
+	return nil
+}
+
+// SetAreas sets the areas whose program guides are scanned in addition to the detected area.  e.g. ["JP13", "JP27"]
+// The programs of the stations outside the detected area are matched, but can't be recorded.
+func (l *Library) SetAreas(areas []string) error {
+	configured := make([]string, 0, len(areas))
+	for _, area := range areas {
+		area = strings.ToUpper(strings.TrimSpace(area))
+		if err := validateArea(area); err != nil {
+			return err
+		}
+		configured = appendArea(configured, area)
+	}
+	l.mu.Lock()
+	l.areas = configured
+	l.mu.Unlock()
+	l.scheduler.requestScan()
+	return nil
+}
+
+// Area returns the detected area and the configured areas.
+func (l *Library) Area() (*AreaStatus, error) {
+	detected, err := l.source.AreaID(l.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to detect area: %w", err)
+	}
+	return &AreaStatus{Detected: detected, Areas: l.libraryAreas(detected)}, nil
+}
+
+// libraryAreas returns the detected area and the configured areas.
+func (l *Library) libraryAreas(detected string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	areas := []string{detected}
+	for _, area := range l.areas {
+		areas = appendArea(areas, area)
+	}
+	return areas
+}
+
+// listStations returns the stations of the areas without duplicates.
+// The errors of the areas are returned in errs, and the stations of the other areas are still returned.
+func (l *Library) listStations(areas []string) (stations []*areaStation, errs map[string]error) {
+	errs = make(map[string]error)
+	found := make(map[string]*areaStation)
+	for _, area := range areas {
+		list, err := l.guides.stations(l.ctx, area)
+		if err != nil {
+			errs[area] = err
+			continue
+		}
+		for _, station := range list {
+			s, ok := found[station.ID]
+			if !ok {
+				s = &areaStation{Station: station}
+				found[station.ID] = s
+				stations = append(stations, s)
+			}
+			s.areas = appendArea(s.areas, area)
+		}
+	}
+	return stations, errs
+}
+
+// checkReachable returns ErrStationOutOfArea if the station is found only in the guides of the other areas.
+// Unknown stations are left to radiko, and the check is skipped if the guides are not available.
+func (l *Library) checkReachable(stationID string) error {
+	detected, err := l.source.AreaID(l.ctx)
+	if err != nil {
+		return nil
+	}
+	areas := l.libraryAreas(detected)
+	for _, rule := range l.keywords.list() {
+		for _, area := range rule.Areas {
+			areas = appendArea(areas, area)
+		}
+	}
+	stations, errs := l.listStations(areas)
+	if errs[detected] != nil {
+		return nil
+	}
+	for _, station := range stations {
+		if station.ID == stationID && !containsString(station.areas, detected) {
+			return fmt.Errorf("%w: stationID=%s is in %s, but the reachable area is %s",
+				ErrStationOutOfArea, stationID, strings.Join(station.areas, ","), detected)
+		}
+	}
+	return nil
+}
+
+func appendArea(areas []string, area string) []string {
+	if containsString(areas, area) {
+		return areas
+	}
+	return append(areas, area)
+}
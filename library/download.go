@@ -1,30 +1,56 @@
 package library
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	maxAttempts    = 4
 	maxConcurrents = 10
+	// partSuffix is the suffix of the file being downloaded.
+	// The file is renamed after its size is verified, so the files without the suffix are complete.
+	partSuffix = ".part"
 )
 
+// chunkTimeLayout is the layout of the time part of the chunk file name. e.g. 20201231_230000_1hVP0.aac
+const chunkTimeLayout = "20060102_150405"
+
+var chunkTimePattern = regexp.MustCompile(`^\d{8}_\d{6}`)
+
 var sem = make(chan struct{}, maxConcurrents)
 
-func bulkDownload(list []string, output string, progressFunc func(float32)) error {
-	var errFlag bool
+func bulkDownload(ctx context.Context, list []string, output string, progressFunc func(float32)) error {
+	var errFlag int32
 	var wg sync.WaitGroup
 
+	existing, err := completedChunks(output)
+	if err != nil {
+		return err
+	}
+
 	total := len(list)
 	downloaded := int32(0)
 	for _, v := range list {
+		_, fileName := filepath.Split(v)
+		if _, ok := existing[chunkKey(fileName)]; ok {
+			// already downloaded by the previous attempt
+			d := float32(atomic.AddInt32(&downloaded, 1))
+			progressFunc(d / float32(total))
+			continue
+		}
 		wg.Add(1)
 		go func(link string) {
 			defer func() {
@@ -33,46 +59,127 @@ func bulkDownload(list []string, output string, progressFunc func(float32)) erro
 				progressFunc(d / float32(total))
 			}()
 
-			var err error
-			for i := 0; i < maxAttempts; i++ {
-				sem <- struct{}{}
-				err = download(link, output)
-				<-sem
-				if err == nil {
-					break
-				}
-			}
+			err := retry(ctx, func() error {
+				return acquireAndDownload(ctx, link, output)
+			})
 			if err != nil {
 				log.Printf("Failed to download: %s", err)
-				errFlag = true
+				atomic.StoreInt32(&errFlag, 1)
 			}
 		}(v)
 	}
 	wg.Wait()
 	progressFunc(1)
 
-	if errFlag {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&errFlag) != 0 {
 		return errors.New("Lack of aac files")
 	}
 	return nil
 }
 
-func download(link, output string) error {
-	resp, err := http.Get(link)
+// retry calls fn until it succeeds up to maxAttempts times, backing off between the attempts.
+func retry(ctx context.Context, fn func() error) error {
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		if i > 0 {
+			// back off before retrying
+			select {
+			case <-time.After(time.Duration(i) * time.Second):
+			case <-ctx.Done():
+			}
+		}
+		err = fn()
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// acquireAndDownload downloads the file limiting the number of concurrent downloads.
+func acquireAndDownload(ctx context.Context, link, output string) error {
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-sem }()
+	return download(ctx, link, output)
+}
+
+func download(ctx context.Context, link, output string) error {
+	_, fileName := filepath.Split(link)
+	return downloadFile(ctx, link, filepath.Join(output, fileName))
+}
+
+// downloadFile downloads the link to the dest file.
+// The file is written to the temporary file first and renamed after its size is verified.
+func downloadFile(ctx context.Context, link, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: url=%s, status=%s", link, resp.Status)
+	}
 
-	_, fileName := filepath.Split(link)
-	file, err := os.Create(filepath.Join(output, fileName))
+	part := dest + partSuffix
+	file, err := os.Create(part)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(file, resp.Body)
+	n, err := io.Copy(file, resp.Body)
 	if closeErr := file.Close(); err == nil {
 		err = closeErr
 	}
-	return err
+	if err == nil && resp.ContentLength >= 0 && n != resp.ContentLength {
+		err = fmt.Errorf("size mismatch: url=%s, expected=%d, actual=%d", link, resp.ContentLength, n)
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("empty file: url=%s", link)
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, dest)
+}
+
+// completedChunks returns the keys of the chunk files completely downloaded in the dir.
+// Incomplete files left by the interrupted download are removed.
+func completedChunks(dir string) (map[string]struct{}, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make(map[string]struct{})
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), partSuffix) || f.Size() == 0 {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		chunks[chunkKey(f.Name())] = struct{}{}
+	}
+	return chunks, nil
+}
+
+// chunkKey returns the key to identify the chunk.
+// Chunk file names have random suffixes which differ by the playlist, so the time part is used if available.
+func chunkKey(fileName string) string {
+	if t := chunkTimePattern.FindString(fileName); len(t) > 0 {
+		return t
+	}
+	return fileName
 }
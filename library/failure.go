@@ -0,0 +1,68 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// failureBackoff is the delay before the scan retries the program which failed to be recorded.
+	// It doubles by every failure up to maxFailureBackoff.
+	failureBackoff    = time.Hour
+	maxFailureBackoff = 24 * time.Hour
+	// maxRecordFailures is the number of the failures after which the scan gives up the program.
+	maxRecordFailures = 5
+)
+
+// programFailure is the record of the failed recordings of the program.
+// The scans back off the program by it so that the program which is not available is not retried every scan.
+type programFailure struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	Error       string    `json:"error"`
+}
+
+// retryAt returns the time when the scan may retry the program.  The zero time is returned if the scan gives up.
+func (f *programFailure) retryAt() time.Time {
+	if f.Failures >= maxRecordFailures {
+		return time.Time{}
+	}
+	backoff := failureBackoff
+	for i := 1; i < f.Failures && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxFailureBackoff {
+		backoff = maxFailureBackoff
+	}
+	return f.LastFailure.Add(backoff)
+}
+
+// recordResult updates the failure record of the program by the result of the recording job.
+// Canceled jobs are not counted as failures.
+func (l *Library) recordResult(ctx context.Context, stationID string, start time.Time, err error) {
+	if err == nil {
+		if err := l.store.deleteFailure(stationID, start); err != nil {
+			log.Warnf("Failed to clear the recording failures: stationID=%s, start=%s, err=%v", stationID, start, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	failure, ferr := l.store.failure(stationID, start)
+	if ferr != nil {
+		log.Warnf("Failed to load the recording failures: stationID=%s, start=%s, err=%v", stationID, start, ferr)
+		return
+	}
+	if failure == nil {
+		failure = &programFailure{}
+	}
+	failure.Failures++
+	failure.LastFailure = time.Now()
+	failure.Error = err.Error()
+	if err := l.store.putFailure(stationID, start, failure); err != nil {
+		log.Warnf("Failed to save the recording failures: stationID=%s, start=%s, err=%v", stationID, start, err)
+	}
+}
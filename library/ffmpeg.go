@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 type ffmpeg struct {
@@ -63,7 +64,8 @@ func (f *ffmpeg) stderrPipe() (io.ReadCloser, error) {
 }
 
 // ConvertAACtoMP3 converts an aac file to a mp3 file.
-func ConvertAACtoMP3(ctx context.Context, input, output string) error {
+// bitrate is in kbps, zero means VBR.
+func ConvertAACtoMP3(ctx context.Context, input, output string, bitrate int) error {
 	f, err := newFfmpeg(ctx)
 	if err != nil {
 		return err
@@ -73,13 +75,72 @@ func ConvertAACtoMP3(ctx context.Context, input, output string) error {
 	f.setArgs(
 		"-c:a", "libmp3lame",
 		"-ac", "2",
-		"-q:a", "2",
-		"-y", // overwrite the output file without asking
 	)
+	if bitrate > 0 {
+		f.setArgs("-b:a", fmt.Sprintf("%dk", bitrate))
+	} else {
+		f.setArgs("-q:a", "2")
+	}
+	f.setArgs("-y") // overwrite the output file without asking
 	// TODO: Collect log
 	return f.run(output)
 }
 
+// RemuxAACtoM4A puts an adts aac file into the mp4 container without re-encoding.
+// The index is placed at the beginning of the file for seeking while streaming.
+func RemuxAACtoM4A(ctx context.Context, input, output string) error {
+	f, err := newFfmpeg(ctx)
+	if err != nil {
+		return err
+	}
+
+	f.setInput(input)
+	f.setArgs(
+		"-c:a", "copy",
+		"-bsf:a", "aac_adtstoasc",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		"-y",
+	)
+	return f.run(output)
+}
+
+// ConvertAACtoOpus converts an aac file to an ogg opus file.
+// bitrate is in kbps, zero means 64kbps.
+func ConvertAACtoOpus(ctx context.Context, input, output string, bitrate int) error {
+	f, err := newFfmpeg(ctx)
+	if err != nil {
+		return err
+	}
+
+	if bitrate <= 0 {
+		bitrate = 64
+	}
+	f.setInput(input)
+	f.setArgs(
+		"-c:a", "libopus",
+		"-b:a", fmt.Sprintf("%dk", bitrate),
+		"-f", "ogg",
+		"-y",
+	)
+	return f.run(output)
+}
+
+// ConvertAACtoFLAC converts an aac file to a flac file.
+func ConvertAACtoFLAC(ctx context.Context, input, output string) error {
+	f, err := newFfmpeg(ctx)
+	if err != nil {
+		return err
+	}
+
+	f.setInput(input)
+	f.setArgs(
+		"-c:a", "flac",
+		"-y",
+	)
+	return f.run(output)
+}
+
 // ConcatAACFilesFromList concatenates files from the list of resources.
 func ConcatAACFilesFromList(ctx context.Context, resourcesDir string) (string, error) {
 	files, err := ioutil.ReadDir(resourcesDir)
@@ -89,6 +150,9 @@ func ConcatAACFilesFromList(ctx context.Context, resourcesDir string) (string, e
 
 	allFilePaths := []string{}
 	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), partSuffix) {
+			continue
+		}
 		p := filepath.Join(resourcesDir, f.Name())
 		allFilePaths = append(allFilePaths, p)
 	}
@@ -169,3 +233,64 @@ func generateFileList(resourcesDir string, input []string) (string, error) {
 	}
 	return listFile.Name(), nil
 }
+
+// Metadata is the tags embedded to the audio file.
+type Metadata struct {
+	Title   string
+	Artist  string
+	Album   string
+	Date    string
+	Comment string
+	Genre   string
+	// Cover is the path of the cover image.  Empty means no cover.
+	Cover string
+}
+
+// TagAudioFile copies the audio file with the metadata tags without re-encoding.
+// The cover image is embedded to mp3, m4a and flac files.  The format is decided by the extension of the output.
+func TagAudioFile(ctx context.Context, input, output string, metadata Metadata) error {
+	f, err := newFfmpeg(ctx)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(output))
+	cover := len(metadata.Cover) > 0 && (ext == ".mp3" || ext == ".m4a" || ext == ".flac")
+	f.setInput(input)
+	if cover {
+		f.setInput(metadata.Cover)
+		f.setArgs(
+			"-map", "0:a",
+			"-map", "1:v",
+			"-disposition:v", "attached_pic",
+			"-metadata:s:v", "title=Cover",
+			"-metadata:s:v", "comment=Cover (front)",
+		)
+	} else {
+		f.setArgs("-map", "0:a")
+	}
+	f.setArgs(
+		"-c", "copy",
+		"-map_metadata", "-1",
+	)
+	if ext == ".mp3" {
+		f.setArgs("-id3v2_version", "3")
+	}
+	if ext == ".m4a" {
+		f.setArgs("-f", "mp4", "-movflags", "+faststart")
+	}
+	for _, kv := range [][2]string{
+		{"title", metadata.Title},
+		{"artist", metadata.Artist},
+		{"album", metadata.Album},
+		{"date", metadata.Date},
+		{"comment", metadata.Comment},
+		{"genre", metadata.Genre},
+	} {
+		if len(kv[1]) > 0 {
+			f.setArgs("-metadata", kv[0]+"="+kv[1])
+		}
+	}
+	f.setArgs("-y")
+	return f.run(output)
+}
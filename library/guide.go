@@ -0,0 +1,240 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/yyoshiki41/go-radiko"
+)
+
+const (
+	DefaultGuideRefreshInterval = 6 * time.Hour
+	// timeshiftWindow is the period the programs are available for the timeshift play after the broadcast.
+	timeshiftWindow = 7 * 24 * time.Hour
+	// dayStartHour is the hour the broadcast day of radiko starts.  Programs until 29:00 belong to the day.
+	dayStartHour = 5
+)
+
+type (
+	// Station is the radio station.
+	Station struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Logo string `json:"logo"`
+		// Areas is the areas the station is available in.
+		Areas []string `json:"areas"`
+		// Reachable is true if the station is in the detected area and can be recorded.
+		Reachable bool `json:"reachable"`
+	}
+
+	// Program is the program in the weekly guide.
+	Program struct {
+		StationID   string    `json:"stationId"`
+		Start       time.Time `json:"start"`
+		End         time.Time `json:"end"`
+		Title       string    `json:"title"`
+		Subtitle    string    `json:"subtitle,omitempty"`
+		Performer   string    `json:"performer,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Info        string    `json:"info,omitempty"`
+		URL         string    `json:"url,omitempty"`
+		// Status is the status of the recording.  Empty if the program is not recorded.
+		Status string `json:"status,omitempty"`
+		// Recorded is true if the recording is ready.
+		Recorded bool `json:"recorded"`
+		// Timeshift is true if the program can be recorded by the timeshift play now.
+		Timeshift bool `json:"timeshift"`
+	}
+
+	// guideCache caches the station list and the weekly program guides in the store.
+	// Guides older than the refresh interval are fetched again, and the stale ones are used if the fetch fails.
+	guideCache struct {
+		store  store
+		source ProgramSource
+		// mu serializes the fetches and guards refreshInterval
+		mu              sync.Mutex
+		refreshInterval time.Duration
+	}
+)
+
+func newGuideCache(store store, source ProgramSource) *guideCache {
+	return &guideCache{store: store, source: source, refreshInterval: DefaultGuideRefreshInterval}
+}
+
+func stationsGuideKey(areaID string) string {
+	return "stations/" + areaID
+}
+
+func weeklyGuideKey(stationID string) string {
+	return "weekly/" + stationID
+}
+
+// stations returns the stations available in the area.
+func (g *guideCache) stations(ctx context.Context, areaID string) (radiko.Stations, error) {
+	return g.get(stationsGuideKey(areaID), func() (radiko.Stations, error) {
+		stations, err := g.source.GetStations(ctx, areaID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		// only the station list is cached
+		for i := range stations {
+			stations[i].Progs = radiko.Progs{}
+			stations[i].Scd = radiko.Scd{}
+		}
+		return stations, nil
+	})
+}
+
+// weekly returns the weekly programs of the station.
+func (g *guideCache) weekly(ctx context.Context, stationID string) (radiko.Stations, error) {
+	return g.get(weeklyGuideKey(stationID), func() (radiko.Stations, error) {
+		return g.source.GetWeeklyPrograms(ctx, stationID)
+	})
+}
+
+func (g *guideCache) get(key string, fetch func() (radiko.Stations, error)) (radiko.Stations, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cached, err := g.store.guide(key)
+	if err != nil {
+		log.Warnf("Failed to load cached guide: key=%s, err=%v", key, err)
+		cached = nil
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < g.refreshInterval {
+		return cached.Stations, nil
+	}
+	stations, err := fetch()
+	if err != nil {
+		if cached != nil {
+			log.Warnf("Failed to refresh guide, using the cached one: key=%s, err=%v", key, err)
+			return cached.Stations, nil
+		}
+		return nil, err
+	}
+	if err := g.store.putGuide(key, &storedGuide{Stations: stations, FetchedAt: time.Now()}); err != nil {
+		log.Warnf("Failed to cache guide: key=%s, err=%v", key, err)
+	}
+	return stations, nil
+}
+
+func (g *guideCache) setRefreshInterval(interval time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refreshInterval = interval
+}
+
+// SetGuideRefreshInterval sets the interval to refresh the cached program guides.
+func (l *Library) SetGuideRefreshInterval(interval time.Duration) {
+	l.guides.setRefreshInterval(interval)
+}
+
+// Stations returns the stations of the area.
+// If areaID is empty, the stations of the detected area and the configured areas are returned.
+func (l *Library) Stations(areaID string) ([]Station, error) {
+	detected, err := l.source.AreaID(l.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to detect area: %w", err)
+	}
+	areas := []string{areaID}
+	if len(areaID) == 0 {
+		areas = l.libraryAreas(detected)
+	} else if err := validateArea(areaID); err != nil {
+		return nil, err
+	}
+	stations, errs := l.listStations(areas)
+	for _, area := range areas {
+		if err := errs[area]; err != nil {
+			return nil, fmt.Errorf("Failed to get stations: areaID=%s, err=%w", area, err)
+		}
+	}
+	// the stations of other areas may be also in the detected area.  e.g. RN1
+	reachable := make(map[string]bool)
+	if !containsString(areas, detected) {
+		if list, err := l.guides.stations(l.ctx, detected); err == nil {
+			for _, station := range list {
+				reachable[station.ID] = true
+			}
+		}
+	}
+	result := make([]Station, 0, len(stations))
+	for _, station := range stations {
+		result = append(result, Station{
+			ID:        station.ID,
+			Name:      station.Name,
+			Logo:      stationLogoURL(station.ID),
+			Areas:     station.areas,
+			Reachable: reachable[station.ID] || containsString(station.areas, detected),
+		})
+	}
+	return result, nil
+}
+
+// Programs returns the programs of the station in the weekly guide.
+// If date is not zero, only the programs of the broadcast day (05:00 to 29:00) are returned.
+// It returns ErrStationNotFound if the station is not available in the detected and the configured areas.
+func (l *Library) Programs(stationID string, date time.Time) ([]Program, error) {
+	stations, err := l.Stations("")
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, station := range stations {
+		found = found || station.ID == stationID
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: stationID=%s", ErrStationNotFound, stationID)
+	}
+
+	guide, err := l.guides.weekly(l.ctx, stationID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get weekly programs: stationID=%s, err=%w", stationID, err)
+	}
+	var from, to time.Time
+	if !date.IsZero() {
+		d := date.In(l.location)
+		from = time.Date(d.Year(), d.Month(), d.Day(), dayStartHour, 0, 0, 0, l.location)
+		to = from.AddDate(0, 0, 1)
+	}
+
+	now := time.Now()
+	programs := make([]Program, 0)
+	for _, station := range guide {
+		for _, prog := range station.Progs.Progs {
+			start, err := l.ParseTime(prog.Ft)
+			if err != nil {
+				log.Warnf("Skip program with invalid start time: stationID=%s, prog=%v", stationID, prog)
+				continue
+			}
+			end, err := l.ParseTime(prog.To)
+			if err != nil {
+				log.Warnf("Skip program with invalid end time: stationID=%s, prog=%v", stationID, prog)
+				continue
+			}
+			if !from.IsZero() && (start.Before(from) || !start.Before(to)) {
+				continue
+			}
+			p := Program{
+				StationID:   stationID,
+				Start:       start,
+				End:         end,
+				Title:       prog.Title,
+				Subtitle:    prog.SubTitle,
+				Performer:   prog.Pfm,
+				Description: prog.Desc,
+				Info:        prog.Info,
+				URL:         prog.URL,
+				Timeshift:   end.Before(now) && start.After(now.Add(-timeshiftWindow)),
+			}
+			if status, ok := l.index.status(stationID, start); ok {
+				p.Status = status
+				p.Recorded = status == StatusReady
+			}
+			programs = append(programs, p)
+		}
+	}
+	return programs, nil
+}
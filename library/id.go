@@ -0,0 +1,15 @@
+package library
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID generates a random identifier for keyword rules and jobs.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,259 @@
+package library
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SortStartAsc  = "start"
+	SortStartDesc = "-start"
+	SortTitleAsc  = "title"
+	SortTitleDesc = "-title"
+)
+
+type (
+	// Query is the condition to search the recordings.  Zero values match every recording.
+	Query struct {
+		// Text is the space separated terms searched from title, subtitle, description and performer.
+		Text      string
+		StationID string
+		RuleID    string
+		// From and To restrict the program start time. [From, To)
+		From   time.Time
+		To     time.Time
+		Status string
+		// Sort is one of "start", "-start" (default), "title" and "-title".
+		Sort string
+		// Limit is the maximum number of the recordings.  Zero means no limit.
+		Limit int
+		// Cursor is the NextCursor of the previous page.
+		Cursor string
+	}
+
+	// Page is the result of the search.
+	Page struct {
+		Recordings []Recording `json:"recordings"`
+		// NextCursor is empty if there are no more recordings.
+		NextCursor string `json:"nextCursor,omitempty"`
+	}
+
+	// index is the in-memory index of the recordings.
+	index struct {
+		entries map[string]*indexEntry
+		mu      sync.RWMutex
+	}
+
+	indexEntry struct {
+		recording Recording
+		status    string
+		// text is the normalized text for the full-text search
+		text string
+	}
+
+	cursor struct {
+		Value string `json:"v"`
+		Key   string `json:"k"`
+	}
+)
+
+func newIndex() *index {
+	return &index{entries: make(map[string]*indexEntry)}
+}
+
+func indexKey(stationID string, start time.Time) string {
+	return stationID + "/" + start.Format(DatetimeLayout)
+}
+
+func newIndexEntry(detail *RecordingDetail, status string) *indexEntry {
+	text := normalize(strings.Join([]string{detail.Title, detail.Subtitle, plainText(detail.Description), detail.Performer}, "\n"))
+	return &indexEntry{detail.Recording, status, text}
+}
+
+// replace replaces all the entries.
+func (x *index) replace(entries map[string]*indexEntry) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.entries = entries
+}
+
+func (x *index) put(detail *RecordingDetail, status string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.entries[indexKey(detail.StationID, detail.Start)] = newIndexEntry(detail, status)
+}
+
+func (x *index) setStatus(stationID string, start time.Time, status string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.entries[indexKey(stationID, start)]; ok {
+		e.status = status
+	}
+}
+
+func (x *index) setPinned(stationID string, start time.Time, pinned bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.entries[indexKey(stationID, start)]; ok {
+		e.recording.Pinned = pinned
+	}
+}
+
+// status returns the status of the recording.  ok is false if the recording is not in the index.
+func (x *index) status(stationID string, start time.Time) (status string, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	e, ok := x.entries[indexKey(stationID, start)]
+	if !ok {
+		return "", false
+	}
+	return e.status, true
+}
+
+func (x *index) remove(stationID string, start time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.entries, indexKey(stationID, start))
+}
+
+func (x *index) list() []Recording {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	recordings := make([]Recording, 0, len(x.entries))
+	for _, e := range x.entries {
+		recordings = append(recordings, e.recording)
+	}
+	return recordings
+}
+
+func (x *index) search(q Query) (*Page, error) {
+	var sortValue func(r *Recording) string
+	desc := false
+	switch q.Sort {
+	case "", SortStartDesc:
+		sortValue, desc = startSortValue, true
+	case SortStartAsc:
+		sortValue = startSortValue
+	case SortTitleDesc:
+		sortValue, desc = titleSortValue, true
+	case SortTitleAsc:
+		sortValue = titleSortValue
+	default:
+		return nil, fmt.Errorf("%w: unknown sort: %s", ErrInvalidQuery, q.Sort)
+	}
+	var after *cursor
+	if len(q.Cursor) > 0 {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = c
+	}
+	terms := strings.Fields(normalize(q.Text))
+
+	// filter
+	type item struct {
+		recording Recording
+		value     string
+		key       string
+	}
+	x.mu.RLock()
+	items := make([]item, 0)
+	for key, e := range x.entries {
+		if !e.match(q, terms) {
+			continue
+		}
+		items = append(items, item{e.recording, sortValue(&e.recording), key})
+	}
+	x.mu.RUnlock()
+
+	// sort, the key breaks the tie to make the order stable
+	less := func(v1, k1, v2, k2 string) bool {
+		if v1 == v2 {
+			v1, v2 = k1, k2
+		}
+		if desc {
+			return v1 > v2
+		}
+		return v1 < v2
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i].value, items[i].key, items[j].value, items[j].key)
+	})
+
+	// paginate
+	begin := 0
+	if after != nil {
+		begin = sort.Search(len(items), func(i int) bool {
+			return less(after.Value, after.Key, items[i].value, items[i].key)
+		})
+	}
+	end := len(items)
+	if q.Limit > 0 && begin+q.Limit < end {
+		end = begin + q.Limit
+	}
+	page := &Page{Recordings: make([]Recording, 0, end-begin)}
+	for _, item := range items[begin:end] {
+		page.Recordings = append(page.Recordings, item.recording)
+	}
+	if end < len(items) {
+		last := items[end-1]
+		page.NextCursor = encodeCursor(&cursor{last.value, last.key})
+	}
+	return page, nil
+}
+
+func (e *indexEntry) match(q Query, terms []string) bool {
+	r := &e.recording
+	if len(q.StationID) > 0 && r.StationID != q.StationID {
+		return false
+	}
+	if len(q.RuleID) > 0 && r.RuleID != q.RuleID {
+		return false
+	}
+	if !q.From.IsZero() && r.Start.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !r.Start.Before(q.To) {
+		return false
+	}
+	if len(q.Status) > 0 && e.status != q.Status {
+		return false
+	}
+	for _, term := range terms {
+		if !strings.Contains(e.text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+func startSortValue(r *Recording) string {
+	return r.Start.UTC().Format(DatetimeLayout)
+}
+
+func titleSortValue(r *Recording) string {
+	return normalize(r.Title)
+}
+
+func encodeCursor(c *cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
@@ -0,0 +1,392 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	JobQueued    = "QUEUED"
+	JobRunning   = "RUNNING"
+	JobSucceeded = "SUCCEEDED"
+	JobFailed    = "FAILED"
+	JobCanceled  = "CANCELED"
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobNotCancelable = errors.New("job already finished")
+	ErrJobNotRetryable  = errors.New("job is not failed")
+)
+
+const (
+	maxJobWorkers = 2
+	maxJobHistory = 500
+)
+
+type (
+	// Job is a recording request processed by the job queue.
+	Job struct {
+		ID        string    `json:"id"`
+		StationID string    `json:"stationId"`
+		Start     time.Time `json:"start"`
+		RuleID    string    `json:"ruleId,omitempty"`
+		// Live jobs record the live stream from ScheduledAt instead of the timeshift playlist.
+		Live bool `json:"live,omitempty"`
+		// ScheduledAt is the time to start the job.  Nil means as soon as possible.
+		ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+		State       string     `json:"state"`
+		Error       string     `json:"error,omitempty"`
+		Retries     int        `json:"retries,omitempty"`
+		CreatedAt   time.Time  `json:"createdAt"`
+		StartedAt   *time.Time `json:"startedAt,omitempty"`
+		FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	}
+
+	// jobQueue is a persistent FIFO queue of the jobs.
+	// Jobs are stored to the storage on every state change so that interrupted jobs can be resumed.
+	// Live jobs are started at their scheduled time regardless of the number of the workers
+	// because they last as long as the programs.
+	jobQueue struct {
+		store   store
+		jobs    []*Job
+		run     func(ctx context.Context, job Job) error
+		cancels map[string]context.CancelFunc
+		mu      sync.Mutex
+		cond    *sync.Cond
+		started bool
+	}
+)
+
+func (j *Job) finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCanceled
+}
+
+func loadJobQueue(store store, run func(ctx context.Context, job Job) error) (*jobQueue, error) {
+	q := &jobQueue{store: store, run: run, cancels: make(map[string]context.CancelFunc)}
+	q.cond = sync.NewCond(&q.mu)
+
+	jobs, err := store.jobs()
+	if err != nil {
+		return nil, err
+	}
+	q.jobs = jobs
+	// jobs which were running on the last shutdown are interrupted
+	for _, job := range q.jobs {
+		if job.State == JobRunning {
+			job.State = JobQueued
+			job.StartedAt = nil
+		}
+	}
+	return q, nil
+}
+
+// jobRequest is the recording requested to the queue.
+type jobRequest struct {
+	stationID   string
+	start       time.Time
+	ruleID      string
+	live        bool
+	scheduledAt *time.Time
+}
+
+// start starts the workers.  Queued jobs are processed in order.
+func (q *jobQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+	for i := 0; i < maxJobWorkers; i++ {
+		go q.work()
+	}
+	for _, job := range q.jobs {
+		if job.State == JobQueued {
+			q.schedule(job)
+		}
+	}
+}
+
+func (q *jobQueue) work() {
+	for {
+		q.mu.Lock()
+		job := q.next()
+		for job == nil {
+			q.cond.Wait()
+			job = q.next()
+		}
+		ctx := q.begin(job)
+		q.mu.Unlock()
+
+		q.execute(ctx, job)
+	}
+}
+
+// schedule wakes up the queue at the scheduled time of the job.
+// Live jobs are started by the timer instead of the workers.
+func (q *jobQueue) schedule(job *Job) {
+	var delay time.Duration
+	if job.ScheduledAt != nil {
+		delay = time.Until(*job.ScheduledAt)
+	}
+	if !job.Live {
+		if delay > 0 {
+			time.AfterFunc(delay, func() {
+				q.mu.Lock()
+				q.cond.Broadcast()
+				q.mu.Unlock()
+			})
+		}
+		return
+	}
+	id := job.ID
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		job := q.find(id)
+		// the job may be canceled or rescheduled
+		if job == nil || job.State != JobQueued || (job.ScheduledAt != nil && time.Now().Before(*job.ScheduledAt)) {
+			q.mu.Unlock()
+			return
+		}
+		ctx := q.begin(job)
+		q.mu.Unlock()
+
+		q.execute(ctx, job)
+	})
+}
+
+// begin marks the job running.  q.mu must be held.
+func (q *jobQueue) begin(job *Job) context.Context {
+	now := time.Now()
+	job.State = JobRunning
+	job.StartedAt = &now
+	if err := q.save(job); err != nil {
+		log.Errorf("Failed to save jobs: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancels[job.ID] = cancel
+	return ctx
+}
+
+// execute runs the job and saves the result.
+func (q *jobQueue) execute(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	j := *job
+	q.mu.Unlock()
+
+	log.Infof("Running job: id=%s, stationID=%s, start=%s, live=%v", j.ID, j.StationID, j.Start, j.Live)
+	err := q.run(ctx, j)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// check before releasing the context, which makes ctx.Err() non-nil
+	canceled := ctx.Err() != nil
+	q.cancels[j.ID]()
+	delete(q.cancels, j.ID)
+	now := time.Now()
+	job.FinishedAt = &now
+	if canceled {
+		log.Infof("Job canceled: id=%s", j.ID)
+		job.State = JobCanceled
+		job.Error = ""
+	} else if err != nil {
+		log.Errorf("Job failed: id=%s, err=%v", j.ID, err)
+		job.State = JobFailed
+		job.Error = err.Error()
+	} else {
+		job.State = JobSucceeded
+	}
+	if err := q.save(job); err != nil {
+		log.Errorf("Failed to save jobs: %v", err)
+	}
+	q.prune()
+}
+
+// next returns the oldest queued job which can be started by the workers.
+func (q *jobQueue) next() *Job {
+	now := time.Now()
+	for _, job := range q.jobs {
+		if job.State == JobQueued && !job.Live && (job.ScheduledAt == nil || !now.Before(*job.ScheduledAt)) {
+			return job
+		}
+	}
+	return nil
+}
+
+// enqueue adds the job for the recording.
+// If the recording already has a queued or running job, it returns the existing one.
+func (q *jobQueue) enqueue(req jobRequest) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.active(req.stationID, req.start); job != nil {
+		return *job, nil
+	}
+	job := &Job{
+		ID:          newID(),
+		StationID:   req.stationID,
+		Start:       req.start,
+		RuleID:      req.ruleID,
+		Live:        req.live,
+		ScheduledAt: req.scheduledAt,
+		State:       JobQueued,
+		CreatedAt:   time.Now(),
+	}
+	q.jobs = append(q.jobs, job)
+	err := q.save(job)
+	if q.started {
+		q.schedule(job)
+	}
+	q.cond.Signal()
+	return *job, err
+}
+
+// active returns the queued or running job of the recording.
+func (q *jobQueue) active(stationID string, start time.Time) *Job {
+	for _, job := range q.jobs {
+		if job.StationID == stationID && job.Start.Equal(start) && !job.finished() {
+			return job
+		}
+	}
+	return nil
+}
+
+// cancel cancels the queued or running job.
+// Running job is stopped by cancelling its context.
+func (q *jobQueue) cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.find(id)
+	if job == nil {
+		return Job{}, ErrJobNotFound
+	}
+	switch job.State {
+	case JobQueued:
+		now := time.Now()
+		job.State = JobCanceled
+		job.FinishedAt = &now
+		return *job, q.save(job)
+	case JobRunning:
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+		return *job, nil
+	}
+	return *job, ErrJobNotCancelable
+}
+
+// cancelQueued cancels the queued job of the recording.
+// It returns ErrRecordingBusy if the job is already running.
+func (q *jobQueue) cancelQueued(stationID string, start time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.active(stationID, start)
+	if job == nil {
+		return nil
+	}
+	if job.State == JobRunning {
+		return ErrRecordingBusy
+	}
+	now := time.Now()
+	job.State = JobCanceled
+	job.FinishedAt = &now
+	return q.save(job)
+}
+
+// retry queues the failed or canceled job again.
+func (q *jobQueue) retry(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.find(id)
+	if job == nil {
+		return Job{}, ErrJobNotFound
+	}
+	if job.State != JobFailed && job.State != JobCanceled {
+		return *job, ErrJobNotRetryable
+	}
+	if active := q.active(job.StationID, job.Start); active != nil {
+		return *active, nil
+	}
+	job.State = JobQueued
+	job.Error = ""
+	job.Retries++
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	err := q.save(job)
+	if q.started {
+		q.schedule(job)
+	}
+	q.cond.Signal()
+	return *job, err
+}
+
+// latest returns the most recent job of the recording.
+func (q *jobQueue) latest(stationID string, start time.Time) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		if job := q.jobs[i]; job.StationID == stationID && job.Start.Equal(start) {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+func (q *jobQueue) find(id string) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (q *jobQueue) get(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.find(id); job != nil {
+		j := *job
+		return &j, true
+	}
+	return nil, false
+}
+
+func (q *jobQueue) list() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// prune drops the oldest finished jobs exceeding maxJobHistory.
+func (q *jobQueue) prune() {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.finished() {
+			finished++
+		}
+	}
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.finished() && finished > maxJobHistory {
+			finished--
+			if err := q.store.deleteJob(job.ID); err != nil {
+				log.Errorf("Failed to delete job: %v", err)
+			}
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	q.jobs = jobs
+}
+
+func (q *jobQueue) save(job *Job) error {
+	return q.store.putJob(job)
+}
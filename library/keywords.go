@@ -2,17 +2,222 @@ package library
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yyoshiki41/go-radiko"
 )
 
+const clockLayout = "15:04"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// KeywordRule is a rule to choose the programs to record.
+// Empty filters match every program.
+type KeywordRule struct {
+	ID      string `json:"id"`
+	Keyword string `json:"keyword"`
+	// Regexp makes the keyword a regular expression.
+	// Otherwise the keyword is matched ignoring full/half width, case and hiragana/katakana.
+	Regexp bool `json:"regexp,omitempty"`
+	// Stations restricts the station IDs. e.g. ["TBS", "QRR"]
+	Stations []string `json:"stations,omitempty"`
+	// Areas restricts the stations to the ones in the areas, and the guides of the areas are scanned
+	// even if they are not configured in the library. e.g. ["JP27"]
+	// Otherwise the stations in the detected area and the configured areas are matched.
+	Areas []string `json:"areas,omitempty"`
+	// Weekdays restricts the weekday of the program start. e.g. ["mon", "fri"]
+	Weekdays []string `json:"weekdays,omitempty"`
+	// StartFrom and StartTo restrict the program start time in "15:04" format.
+	// The window may cross midnight. e.g. "23:00" to "02:00"
+	StartFrom string `json:"startFrom,omitempty"`
+	StartTo   string `json:"startTo,omitempty"`
+	// MinDuration is the minimum program length in minutes.
+	MinDuration int `json:"minDuration,omitempty"`
+	// Exclude is the list of terms which must not appear in the program.
+	Exclude []string `json:"exclude,omitempty"`
+	// Keep is the number of the latest episodes to keep.
+	// Zero means the default of the retention policy.
+	Keep int `json:"keep,omitempty"`
+	// Output overrides the default output profile.
+	Output *OutputProfile `json:"output,omitempty"`
+	// Live records the matched programs from the live stream at their start time instead of the timeshift playlist.
+	// It is for the stations and the programs which are not available for the timeshift play.
+	Live bool `json:"live,omitempty"`
+
+	matcher  matcher
+	excludes []matcher
+}
+
+func (r *KeywordRule) validate() error {
+	r.Keyword = strings.TrimSpace(r.Keyword)
+	if len(r.Keyword) <= 2 {
+		return fmt.Errorf("%w: keyword too short: %s", ErrInvalidKeyword, r.Keyword)
+	}
+	for i, area := range r.Areas {
+		r.Areas[i] = strings.ToUpper(strings.TrimSpace(area))
+		if err := validateArea(r.Areas[i]); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKeyword, err)
+		}
+	}
+	for _, w := range r.Weekdays {
+		if _, ok := weekdays[strings.ToLower(w)]; !ok {
+			return fmt.Errorf("%w: unknown weekday: %s", ErrInvalidKeyword, w)
+		}
+	}
+	for _, t := range []string{r.StartFrom, r.StartTo} {
+		if len(t) == 0 {
+			continue
+		}
+		if _, err := time.Parse(clockLayout, t); err != nil {
+			return fmt.Errorf("%w: invalid time, must be HH:MM: %s", ErrInvalidKeyword, t)
+		}
+	}
+	if r.MinDuration < 0 {
+		return fmt.Errorf("%w: negative minDuration: %d", ErrInvalidKeyword, r.MinDuration)
+	}
+	if r.Keep < 0 {
+		return fmt.Errorf("%w: negative keep: %d", ErrInvalidKeyword, r.Keep)
+	}
+	if r.Output != nil {
+		if err := r.Output.validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKeyword, err)
+		}
+	}
+	for _, e := range r.Exclude {
+		if len(strings.TrimSpace(e)) == 0 {
+			return fmt.Errorf("%w: empty exclusion term", ErrInvalidKeyword)
+		}
+	}
+	return r.compile()
+}
+
+// compile prepares the matchers of the rule.
+func (r *KeywordRule) compile() error {
+	if r.Regexp {
+		m, err := newRegexpMatcher(r.Keyword)
+		if err != nil {
+			return fmt.Errorf("%w: invalid regular expression: %v", ErrInvalidKeyword, err)
+		}
+		r.matcher = m
+	} else {
+		r.matcher = newNormalizedMatcher(r.Keyword)
+	}
+	r.excludes = make([]matcher, len(r.Exclude))
+	for i, e := range r.Exclude {
+		r.excludes[i] = newNormalizedMatcher(e)
+	}
+	return nil
+}
+
+// match returns true if the program should be recorded by this rule.
+func (r *KeywordRule) match(stationID string, prog *radiko.Prog, start, end time.Time) bool {
+	if len(r.Stations) > 0 && !containsString(r.Stations, stationID) {
+		return false
+	}
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, w := range r.Weekdays {
+			if weekdays[strings.ToLower(w)] == start.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !r.matchStartTime(start) {
+		return false
+	}
+	if r.MinDuration > 0 && end.Sub(start) < time.Duration(r.MinDuration)*time.Minute {
+		return false
+	}
+
+	texts := []string{prog.Title, prog.SubTitle, prog.Pfm, prog.Desc, prog.Info}
+	found := false
+	for _, text := range texts {
+		if r.matcher.match(text) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	for _, exclude := range r.excludes {
+		for _, text := range texts {
+			if exclude.match(text) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchArea returns true if the station in stationAreas is the target of this rule.
+func (r *KeywordRule) matchArea(stationAreas []string, libraryAreas []string) bool {
+	areas := r.Areas
+	if len(areas) == 0 {
+		areas = libraryAreas
+	}
+	for _, area := range stationAreas {
+		if containsString(areas, area) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *KeywordRule) matchStartTime(start time.Time) bool {
+	if len(r.StartFrom) == 0 && len(r.StartTo) == 0 {
+		return true
+	}
+	minutes := start.Hour()*60 + start.Minute()
+	from, to := 0, 24*60
+	if t, err := time.Parse(clockLayout, r.StartFrom); err == nil {
+		from = t.Hour()*60 + t.Minute()
+	}
+	if t, err := time.Parse(clockLayout, r.StartTo); err == nil {
+		to = t.Hour()*60 + t.Minute()
+	}
+	if from <= to {
+		return from <= minutes && minutes <= to
+	}
+	// the window crosses midnight
+	return from <= minutes || minutes <= to
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 type keywords struct {
-	keywords map[string]struct{}
-	file     string
+	rules []KeywordRule
+	file  string
+	mu    sync.RWMutex
 }
 
 func loadKeywords(file string) (*keywords, error) {
 	// make empty return value
-	ks := &keywords{make(map[string]struct{}), file}
+	ks := &keywords{rules: make([]KeywordRule, 0), file: file}
 
 	// load keywords file
 	f, err := os.Open(file)
@@ -25,47 +230,102 @@ func loadKeywords(file string) (*keywords, error) {
 		return nil, err
 	}
 	defer f.Close()
-	// decode file as keyword array
-	s := make([]string, 0)
-	if err := json.NewDecoder(f).Decode(&s); err != nil {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(f).Decode(&raw); err != nil {
 		return nil, err
 	}
-	// put keywords to return value (convert slice to map)
-	for _, ss := range s {
-		ks.keywords[ss] = struct{}{}
+	migrated := false
+	for _, r := range raw {
+		var rule KeywordRule
+		// old format: keyword array
+		var s string
+		if err := json.Unmarshal(r, &s); err == nil {
+			rule.Keyword = s
+			migrated = true
+		} else if err := json.Unmarshal(r, &rule); err != nil {
+			return nil, err
+		}
+		if len(rule.ID) == 0 {
+			rule.ID = newID()
+			migrated = true
+		}
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		ks.rules = append(ks.rules, rule)
+	}
+	if migrated {
+		if err := ks.save(); err != nil {
+			return nil, err
+		}
 	}
 	return ks, nil
 }
 
 func (k *keywords) save() error {
-	ks := k.keywordsSlice()
 	f, err := os.Create(k.file)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	if err := json.NewEncoder(f).Encode(ks); err != nil {
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(k.rules); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (k *keywords) add(keyword string) error {
-	k.keywords[keyword] = struct{}{}
-	return k.save()
+func (k *keywords) add(rule KeywordRule) (*KeywordRule, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rule.ID = newID()
+	k.rules = append(k.rules, rule)
+	return &rule, k.save()
 }
 
-func (k *keywords) remove(keyword string) error {
-	delete(k.keywords, keyword)
-	return k.save()
+func (k *keywords) update(rule KeywordRule) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, r := range k.rules {
+		if r.ID == rule.ID {
+			k.rules[i] = rule
+			return k.save()
+		}
+	}
+	return ErrKeywordNotFound
 }
 
-func (k *keywords) keywordsSlice() []string {
-	ks := make([]string, len(k.keywords))
-	i := 0
-	for s := range k.keywords {
-		ks[i] = s
-		i++
+func (k *keywords) remove(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, r := range k.rules {
+		if r.ID == id {
+			k.rules = append(k.rules[:i], k.rules[i+1:]...)
+			return k.save()
+		}
 	}
-	return ks
+	return ErrKeywordNotFound
+}
+
+func (k *keywords) get(id string) (*KeywordRule, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, r := range k.rules {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, ErrKeywordNotFound
+}
+
+func (k *keywords) list() []KeywordRule {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	rules := make([]KeywordRule, len(k.rules))
+	copy(rules, k.rules)
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Keyword < rules[j].Keyword
+	})
+	return rules
 }
@@ -2,12 +2,14 @@ package library
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/labstack/gommon/log"
@@ -15,13 +17,25 @@ import (
 )
 
 type Library struct {
-	baseDir    string
-	location   *time.Location
-	client     *radiko.Client
-	ctx        context.Context
-	recordings []Recording
-	keywords   *keywords
-	lastUpdate *time.Time
+	baseDir  string
+	location *time.Location
+	source   ProgramSource
+	ctx      context.Context
+	store    store
+	index    *index
+	// mu guards retention, output and areas
+	mu sync.RWMutex
+	// loadMu serializes the rebuild and the deletion
+	loadMu    sync.Mutex
+	keywords  *keywords
+	jobs      *jobQueue
+	guides    *guideCache
+	scheduler *scheduler
+	retention Retention
+	output    OutputProfile
+	// areas is the configured areas to scan in addition to the detected area
+	areas     []string
+	fileLocks fileLocks
 }
 
 const (
@@ -29,14 +43,29 @@ const (
 	TZ             = "Asia/Tokyo"
 )
 
+var (
+	ErrInvalidKeyword    = errors.New("invalid keyword")
+	ErrKeywordNotFound   = errors.New("keyword not found")
+	ErrRecordingNotFound = errors.New("recording not found")
+	ErrRecordingBusy     = errors.New("recording job is running")
+	ErrFormatNotFound    = errors.New("format not found")
+	ErrInvalidQuery      = errors.New("invalid query")
+	ErrStationNotFound   = errors.New("station not found")
+	ErrInvalidStation    = errors.New("invalid station")
+)
+
+// New returns the library which records the programs from radiko.
 func New(baseDir string) (*Library, error) {
-	client, err := radiko.New("")
+	source, err := NewRadikoSource()
 	if err != nil {
 		return nil, err
 	}
-	ctx := context.Background()
-	client.AuthorizeToken(ctx)
+	return NewWithSource(baseDir, source)
+}
 
+// NewWithSource returns the library which records the programs from the source.
+func NewWithSource(baseDir string, source ProgramSource) (*Library, error) {
+	ctx := context.Background()
 	location, _ := time.LoadLocation(TZ)
 
 	keywords, err := loadKeywords(filepath.Join(baseDir, "keywords.json"))
@@ -44,24 +73,128 @@ func New(baseDir string) (*Library, error) {
 		return nil, err
 	}
 
-	return &Library{baseDir, location, client, ctx, nil, keywords, nil}, nil
+	store, err := openBoltStore(filepath.Join(baseDir, "library.db"))
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateJobsFile(store, filepath.Join(baseDir, "jobs.json")); err != nil {
+		store.close()
+		return nil, err
+	}
+
+	l := &Library{
+		baseDir:   baseDir,
+		location:  location,
+		source:    source,
+		ctx:       ctx,
+		store:     store,
+		index:     newIndex(),
+		keywords:  keywords,
+		guides:    newGuideCache(store, source),
+		scheduler: newScheduler(),
+		output:    DefaultOutputProfile(),
+	}
+	jobs, err := loadJobQueue(store, func(ctx context.Context, job Job) error {
+		var err error
+		if job.Live {
+			err = l.recordLive(ctx, job.StationID, job.Start, job.RuleID)
+		} else {
+			err = l.record(ctx, job.StationID, job.Start, job.RuleID)
+		}
+		l.recordResult(ctx, job.StationID, job.Start, err)
+		return err
+	})
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+	l.jobs = jobs
+	return l, nil
+}
+
+// Close stops the scheduler and closes the storage of the library.
+func (l *Library) Close() error {
+	l.scheduler.close()
+	return l.store.close()
 }
 
-// Load loads local library file system.
+// Load loads the library from the storage and resumes the interrupted recordings.
+// The storage is rebuilt from the file system if it is empty.
 func (l *Library) Load() error {
-	l.recordings = make([]Recording, 0)
+	stored, err := l.store.recordings()
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 {
+		if err := l.Rebuild(); err != nil {
+			return err
+		}
+	} else {
+		entries := make(map[string]*indexEntry)
+		for _, r := range stored {
+			status := ""
+			if r.Status != nil {
+				status = r.Status.Status
+			}
+			entries[indexKey(r.Detail.StationID, r.Detail.Start)] = newIndexEntry(r.Detail, status)
+		}
+		l.index.replace(entries)
+	}
+	recordings, err := l.List()
+	if err != nil {
+		return err
+	}
+	// recordings stuck in progress without any job were interrupted by the shutdown
+	for _, recording := range recordings {
+		status, err := l.GetStatus(recording.StationID, recording.Start)
+		if err != nil || status.Status == StatusReady || status.Status == StatusError {
+			continue
+		}
+		// live recordings are resumed if the programs are still on the air
+		if _, err := l.jobs.enqueue(jobRequest{
+			stationID: recording.StationID,
+			start:     recording.Start,
+			ruleID:    recording.RuleID,
+			live:      recording.Live,
+		}); err != nil {
+			return err
+		}
+	}
+	l.jobs.start()
+	return nil
+}
+
+// Rebuild rebuilds the storage from the recording directories on the file system.
+func (l *Library) Rebuild() error {
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
+
+	recordings := make([]storedRecording, 0)
+	entries := make(map[string]*indexEntry)
 	filepath.Walk(l.baseDir, func(path string, info os.FileInfo, err error) error {
 		dir, name := filepath.Split(path)
 		if name == "status.json" {
 			d := l.recordingDirectoryFromDir(dir)
 			detail, err := d.loadDetail()
 			if err != nil {
-				return err
+				log.Warnf("Skip broken recording directory: dir=%s, err=%v", dir, err)
+				return nil
+			}
+			status, err := d.loadStatus()
+			if err != nil {
+				log.Warnf("Skip broken recording directory: dir=%s, err=%v", dir, err)
+				return nil
 			}
-			l.recordings = append(l.recordings, detail.Recording)
+			recordings = append(recordings, storedRecording{detail, status})
+			entries[indexKey(detail.StationID, detail.Start)] = newIndexEntry(detail, status.Status)
 		}
 		return nil
 	})
+	if err := l.store.replaceRecordings(recordings); err != nil {
+		return err
+	}
+	l.index.replace(entries)
+	log.Infof("Rebuilt the library: recordings=%d", len(recordings))
 	return nil
 }
 
@@ -77,43 +210,120 @@ func (l *Library) GetStatus(stationID string, start time.Time) (*Status, error)
 
 // List lists all recordings
 func (l *Library) List() ([]Recording, error) {
-	return l.recordings, nil
+	return l.index.list(), nil
 }
 
-func (l *Library) refreshClient() error {
-	if l.lastUpdate != nil && time.Now().Before((*l.lastUpdate).Add(time.Minute*5)) {
-		return nil
+// Search searches the recordings by the query.
+func (l *Library) Search(q Query) (*Page, error) {
+	return l.index.search(q)
+}
+
+// Delete deletes the recording directory and removes it from the library.
+// Queued job of the recording is canceled, but it returns ErrRecordingBusy if the job is running.
+// The program is not recorded again by the scans unless it is recorded by hand.
+func (l *Library) Delete(stationID string, start time.Time) error {
+	return l.delete(stationID, start, DeletedByUser)
+}
+
+func (l *Library) delete(stationID string, start time.Time, reason string) error {
+	// the station ID is a part of the path to remove
+	if err := validateStation(stationID); err != nil {
+		return err
 	}
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
 
-	client, err := radiko.New("")
-	if err != nil {
+	dir := l.recordingDirectory(stationID, start)
+	if !dir.exists() {
+		return ErrRecordingNotFound
+	}
+	if err := l.jobs.cancelQueued(stationID, start); err != nil {
 		return err
 	}
-	ctx := context.Background()
-	client.AuthorizeToken(ctx)
-	l.client = client
-	t := time.Now()
-	l.lastUpdate = &t
-	return nil
+	if err := os.RemoveAll(dir.dir); err != nil {
+		return err
+	}
+	// remove the station directory if it becomes empty
+	os.Remove(filepath.Dir(dir.dir))
+
+	l.index.remove(stationID, start)
+	// the failure is kept so that the scans keep backing off the program
+	if err := l.store.putTombstone(stationID, start, &tombstone{DeletedAt: time.Now(), Reason: reason}); err != nil {
+		return err
+	}
+	return l.store.deleteRecording(stationID, start)
 }
 
-// Record records radiko's program
-func (l *Library) Record(stationID string, start time.Time) error {
+func (l *Library) record(ctx context.Context, stationID string, start time.Time, ruleID string) error {
 	dir := l.recordingDirectory(stationID, start)
-	dir.create()
-
 	if dir.ready() {
 		log.Infof("Already recorded: stationID=%s, start=%s", stationID, start)
 		return nil
 	}
+	// created after the check not to recreate the chunk directory removed after the conversion
+	dir.create()
 
+	if err := l.download(ctx, dir, stationID, start, ruleID); err != nil {
+		// Downloaded files are kept to resume on the next attempt.
+		l.fail(dir, err)
+		return err
+	}
+	return l.finish(ctx, dir, ruleID)
+}
+
+// download saves the program and downloads its chunks from the timeshift playlist.
+func (l *Library) download(ctx context.Context, dir *recordingDirectory, stationID string, start time.Time, ruleID string) error {
 	// Get program
-	if err := l.refreshClient(); err != nil {
+	if _, err := l.saveProgram(ctx, dir, stationID, start, ruleID, false); err != nil {
 		return err
 	}
-	pg, err := l.client.GetProgramByStartTime(l.ctx, stationID, start)
+
+	// Get M3U8 playlist
+	uri, err := l.source.TimeshiftPlaylistM3U8(ctx, stationID, start)
+	if err != nil {
+		return fmt.Errorf("Failed to get m3u8 playlist url.  The radio program may not be ready for timeshift play: %w", err)
+	}
+
+	// Download audio files
+	chunklist, err := radiko.GetChunklistFromM3U8(uri)
+	if err != nil {
+		return fmt.Errorf("Failed to get m3u8: %w", err)
+	}
+
+	// Download
+	if err := bulkDownload(ctx, chunklist, dir.filesDir(), func(progress float32) {
+		dir.updateStatus(&Status{
+			Status:           StatusDownloading,
+			DownloadProgress: progress,
+		}, false)
+	}); err != nil {
+		return fmt.Errorf("Failed to download audio files: %w", err)
+	}
+	return nil
+}
+
+// fail saves the error status of the failed or canceled recording.
+// Otherwise the status is left in progress, and the recording is resumed by every restart.
+// The recording directory is removed instead if the program couldn't be saved.
+func (l *Library) fail(dir *recordingDirectory, err error) {
+	if _, derr := dir.loadDetail(); derr != nil {
+		// remove only the empty directories created by the recording
+		os.Remove(dir.filesDir())
+		os.Remove(dir.dir)
+		os.Remove(filepath.Dir(dir.dir))
+		return
+	}
+	dir.updateStatus(&Status{
+		Status: StatusError,
+		Error:  err.Error(),
+	}, true)
+}
+
+// saveProgram saves the detail of the program to the recording directory and the library before downloading.
+func (l *Library) saveProgram(ctx context.Context, dir *recordingDirectory, stationID string, start time.Time, ruleID string, live bool) (*RecordingDetail, error) {
+	pg, err := l.source.GetProgramByStartTime(ctx, stationID, start)
 	if err != nil {
-		return fmt.Errorf("Failed to get program: stationID=%s, start=%s, cause=%w", stationID, start, err)
+		return nil, fmt.Errorf("Failed to get program: stationID=%s, start=%s, cause=%w", stationID, start, err)
 	}
 	end, _ := l.ParseTime(pg.To)
 
@@ -123,81 +333,48 @@ func (l *Library) Record(stationID string, start time.Time) error {
 			StationID: stationID,
 			Start:     start,
 			End:       end,
+			RuleID:    ruleID,
+			Live:      live,
 		},
 		Description: pg.Desc,
 		Subtitle:    pg.SubTitle,
 		URL:         pg.URL,
 		Info:        pg.Info,
+		Performer:   pg.Pfm,
+	}
+	l.fillMetadata(ctx, &detail)
+	if old, err := dir.loadDetail(); err == nil {
+		// keep the user settings on retry
+		detail.Pinned = old.Pinned
+		if len(detail.RuleID) == 0 {
+			detail.RuleID = old.RuleID
+		}
 	}
 
-	dir.saveDetail(&detail)
-	dir.saveStatus(&Status{
+	status := &Status{
 		Status:           StatusDownloading,
 		DownloadProgress: 0,
-	})
-
-	// reload library
-	go l.Load()
-
-	// Get M3U8 playlist
-	uri, err := l.client.TimeshiftPlaylistM3U8(l.ctx, stationID, start)
-	if err != nil {
-		return fmt.Errorf("Failed to get m3u8 playlist url.  The radio program may not be ready for timeshift play: %w", err)
 	}
-
-	// Download audio files
-	chunklist, err := radiko.GetChunklistFromM3U8(uri)
-	if err != nil {
-		return fmt.Errorf("Failed to get m3u8: %w", err)
+	dir.saveDetail(&detail)
+	if err := l.store.putRecording(&detail, status); err != nil {
+		return nil, err
 	}
+	l.index.put(&detail, status.Status)
+	dir.saveStatus(status)
+	return &detail, nil
+}
 
-	// Download
-	if err := bulkDownload(chunklist, dir.filesDir(), func(progress float32) {
-		dir.updateStatus(&Status{
-			Status:           StatusDownloading,
-			DownloadProgress: progress,
-		}, false)
-	}); err != nil {
-		// Failed to download
-		os.RemoveAll(dir.filesDir())
-		dir.updateStatus(&Status{
-			Status:           StatusError,
-			Error:            fmt.Sprintf("Failed to download audio files: %v", err),
-			DownloadProgress: 0,
-		}, true)
-		return err
-	}
+// finish produces the audio files from the downloaded chunks.
+func (l *Library) finish(ctx context.Context, dir *recordingDirectory, ruleID string) error {
 	dir.updateStatus(&Status{
 		Status:           StatusConverting,
 		DownloadProgress: 1,
 	}, true)
-	// Concat aac files
-	concatedFile, err := ConcatAACFilesFromList(l.ctx, dir.filesDir())
-	if err != nil {
+	// Produce audio files
+	if err := l.convert(ctx, dir, l.outputProfile(ruleID)); err != nil {
 		dir.updateStatus(&Status{
 			Status:           StatusError,
-			Error:            fmt.Sprintf("Failed to concat aac files: %v", err),
-			DownloadProgress: 1,
-		}, true)
-		return err
-	}
-	os.Remove(dir.aacFile())
-	if err := os.Rename(concatedFile, dir.aacFile()); err != nil {
-		os.Remove(concatedFile)
-		dir.updateStatus(&Status{
-			Status:           StatusError,
-			Error:            fmt.Sprintf("Failed to rename aac: %v", err),
-			DownloadProgress: 1,
-		}, true)
-		return err
-	}
-	// Convert aac file
-	os.Remove(dir.mp3File())
-	if err := ConvertAACtoMP3(l.ctx, dir.aacFile(), dir.mp3File()); err != nil {
-		os.Remove(dir.mp3File())
-		dir.updateStatus(&Status{
-			Status:           StatusError,
-			Error:            fmt.Sprintf("Failed to convert aac to mp3: %v", err),
+			Error:            err.Error(),
 			DownloadProgress: 1,
 		}, true)
 		return err
@@ -207,54 +384,130 @@ func (l *Library) Record(stationID string, start time.Time) error {
 		Status:           StatusReady,
 		DownloadProgress: 1,
 	}, true)
+	l.preparePodcast(dir)
 	return nil
 }
 
+// Enqueue adds the recording job to the job queue.
+// If the recording is already queued or running, it returns the existing job.
+// It returns ErrInvalidStation if the station ID can't be a directory name.
+// It returns ErrStationOutOfArea if the station is outside the detected area.
+func (l *Library) Enqueue(stationID string, start time.Time) (*Job, error) {
+	if err := validateStation(stationID); err != nil {
+		return nil, err
+	}
+	if err := l.checkReachable(stationID); err != nil {
+		return nil, err
+	}
+	l.undelete(stationID, start)
+	job, err := l.jobs.enqueue(jobRequest{stationID: stationID, start: start})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Job returns the job.
+func (l *Library) Job(id string) (*Job, error) {
+	job, ok := l.jobs.get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Jobs returns the active and the past jobs, the newest first.
+func (l *Library) Jobs() ([]Job, error) {
+	jobs := l.jobs.list()
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// CancelJob cancels the queued or running job.
+func (l *Library) CancelJob(id string) (*Job, error) {
+	job, err := l.jobs.cancel(id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryJob queues the failed or canceled job again.
+func (l *Library) RetryJob(id string) (*Job, error) {
+	job, err := l.jobs.retry(id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Migrate produces the missing audio files of the output profiles and the podcast feeds,
+// fills the recording details and tags the audio files.
+// The recordings which are not ready are skipped because they are written by the jobs.
 func (l *Library) Migrate() error {
 	recordings, err := l.List()
 	if err != nil {
 		return err
 	}
 	for _, recording := range recordings {
+		dir := l.recordingDirectory(recording.StationID, recording.Start)
+		if !dir.ready() {
+			continue
+		}
 		log.Infof("Migrating recording directory: recording=%v", recording)
-		if err := l.generateAACMP3(recording.StationID, recording.Start); err != nil {
-			log.Errorf("Failed to generate AAC/MP3 file: %s", err)
+		if err := l.backfillDetail(l.ctx, dir); err != nil {
+			log.Errorf("Failed to backfill recording detail: %s", err)
 		}
+		if err := l.produceMissing(dir, l.outputProfile(recording.RuleID)); err != nil {
+			log.Errorf("Failed to produce audio files: %s", err)
+		}
+		l.preparePodcast(dir)
+		l.retag(l.ctx, dir)
 	}
 	return nil
 }
 
-// for migration
-func (l *Library) generateAACMP3(stationID string, start time.Time) error {
-	dir := l.recordingDirectory(stationID, start)
-	aacFile := dir.aacFile()
-	mp3File := dir.mp3File()
-	if _, err := os.Stat(aacFile); os.IsNotExist(err) {
-		concatedFile, err := ConcatAACFilesFromList(l.ctx, dir.filesDir())
-		if err != nil {
-			return err
-		}
-		if err := os.Rename(concatedFile, aacFile); err != nil {
-			os.Remove(concatedFile)
-			return err
-		}
+// produceMissing produces the audio files of the profile if the recording doesn't have some of them,
+// e.g. the recordings of the older versions.
+// The recordings without the chunk files are skipped because the files are produced from the chunks.
+func (l *Library) produceMissing(dir *recordingDirectory, profile OutputProfile) error {
+	if _, err := os.Stat(dir.filesDir()); err != nil {
+		return nil
 	}
-	if _, err := os.Stat(mp3File); os.IsNotExist(err) {
-		// Convert aac file
-		if err := ConvertAACtoMP3(l.ctx, aacFile, mp3File); err != nil {
-			os.Remove(mp3File)
-			return err
+	for _, format := range profile.formats() {
+		if _, err := os.Stat(dir.audioFile(format)); os.IsNotExist(err) {
+			// the lazily produced files are concatenated to the same temporary file
+			unlock := l.fileLocks.lock(dir.dir)
+			defer unlock()
+			return l.convert(l.ctx, dir, profile)
 		}
 	}
 	return nil
 }
 
+// validateStation returns ErrInvalidStation if the station ID can't be a directory name, e.g. "..".
+func validateStation(stationID string) error {
+	if !stationIDPattern.MatchString(stationID) {
+		return fmt.Errorf("%w: %s", ErrInvalidStation, stationID)
+	}
+	return nil
+}
+
 func (l *Library) recordingDirectory(stationID string, start time.Time) *recordingDirectory {
-	return l.recordingDirectoryFromDir(filepath.Join(l.baseDir, stationID, start.Format(DatetimeLayout)))
+	d := l.recordingDirectoryFromDir(filepath.Join(l.baseDir, stationID, start.Format(DatetimeLayout)))
+	d.onStatus = func(status *Status) {
+		l.index.setStatus(stationID, start, status.Status)
+		if err := l.store.putStatus(stationID, start, status); err != nil {
+			log.Errorf("Failed to store status: stationID=%s, start=%s, err=%v", stationID, start, err)
+		}
+	}
+	return d
 }
 
 func (l *Library) recordingDirectoryFromDir(dir string) *recordingDirectory {
-	return &recordingDirectory{dir, nil}
+	return &recordingDirectory{dir: dir}
 }
 
 func (l *Library) ParseTime(start string) (time.Time, error) {
@@ -286,10 +539,17 @@ func (l *Library) GenerateM3U8(baseURL string, stationID string, start time.Time
 
 	f, _ := os.Open(filesDir)
 	defer f.Close()
-	filenames, err := f.Readdirnames(-1)
+	names, err := f.Readdirnames(-1)
 	if err != nil {
 		return err
 	}
+	filenames := make([]string, 0, len(names))
+	for _, name := range names {
+		// skip the files being downloaded
+		if !strings.HasSuffix(name, partSuffix) {
+			filenames = append(filenames, name)
+		}
+	}
 	sort.Slice(filenames, func(i, j int) bool {
 		f1 := filenames[i]
 		f2 := filenames[j]
@@ -306,78 +566,48 @@ func (l *Library) AAC(stationID string, start time.Time) string {
 	return l.recordingDirectory(stationID, start).aacFile()
 }
 
-func (l *Library) RegisterKeyword(keyword string) error {
-	if len(keyword) <= 2 {
-		return fmt.Errorf("keyword too short: %s", keyword)
+// RegisterKeyword adds the keyword rule for the recording.
+// The scheduler scans the programs again with the rule.
+func (l *Library) RegisterKeyword(rule KeywordRule) (*KeywordRule, error) {
+	if err := rule.validate(); err != nil {
+		return nil, err
 	}
-	return l.keywords.add(keyword)
-}
-
-func (l *Library) UnregisterKeyword(keyword string) error {
-	return l.keywords.remove(keyword)
-}
-
-func (l *Library) Keywords() ([]string, error) {
-	return l.keywords.keywordsSlice(), nil
-}
-
-func (l *Library) ScanAndRecord() error {
-	keywords := l.keywords.keywordsSlice()
-	if len(keywords) == 0 {
-		return nil
+	added, err := l.keywords.add(rule)
+	if err != nil {
+		return nil, err
 	}
+	l.scheduler.requestScan()
+	return added, nil
+}
 
-	currentTime := time.Now().Add(-time.Hour)
-	if err := l.refreshClient(); err != nil {
+// UpdateKeyword replaces the keyword rule which has the same ID.
+func (l *Library) UpdateKeyword(rule KeywordRule) error {
+	if err := rule.validate(); err != nil {
 		return err
 	}
-	stations, err := l.client.GetStations(l.ctx, time.Now())
-	if err != nil {
-		return fmt.Errorf("Failed to get stations: %w", err)
+	if err := l.keywords.update(rule); err != nil {
+		return err
 	}
+	l.scheduler.requestScan()
+	return nil
+}
 
-	for _, station := range stations {
-		stationID := station.ID
-		log.Infof("Getting weekly programs: stationID=%s", stationID)
-		programs, err := l.client.GetWeeklyPrograms(l.ctx, stationID)
-		if err != nil {
-			return fmt.Errorf("Failed to get weekly programs: stationID=%s, err=%w", stationID, err)
-		}
-		for _, program := range programs {
-			for _, prog := range program.Progs.Progs {
-				// Check if the program has finished
-				programEnd, err := l.ParseTime(prog.To)
-				if err != nil {
-					return fmt.Errorf("Failed to parse program end time: prog=%v, err=%w", prog, err)
-				}
-				if programEnd.After(currentTime) {
-					continue
-				}
-
-				// Check if the program title match with the keywords
-				found := false
-				for _, keyword := range keywords {
-					if strings.Contains(prog.Title, keyword) {
-						found = true
-						break
-					}
-				}
-				if !found {
-					continue
-				}
-
-				// Download
-				log.Infof("Downloading program: stationID=%s, start=%s, title=%s", stationID, prog.Ft, prog.Title)
-				t, err := l.ParseTime(prog.Ft)
-				if err != nil {
-					return fmt.Errorf("Failed to parse program start time: prog=%v, err=%w", prog, err)
-				}
-				if err := l.Record(stationID, t); err != nil {
-					return fmt.Errorf("Failed to record: stationID=%s, start=%s, err=%w", stationID, prog.Ft, err)
-				}
-			}
-		}
+// UnregisterKeyword removes the keyword rule.
+// It returns ErrKeywordNotFound if the rule is not registered.
+func (l *Library) UnregisterKeyword(id string) error {
+	if err := l.keywords.remove(id); err != nil {
+		return err
 	}
-
+	l.scheduler.requestScan()
 	return nil
 }
+
+// Keyword returns the keyword rule.
+func (l *Library) Keyword(id string) (*KeywordRule, error) {
+	return l.keywords.get(id)
+}
+
+// Keywords returns the registered keyword rules sorted by keyword.
+func (l *Library) Keywords() ([]KeywordRule, error) {
+	return l.keywords.list(), nil
+}
@@ -0,0 +1,73 @@
+package library_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uphy/radiko-server/library"
+	"github.com/uphy/radiko-server/library/librarytest"
+)
+
+// TestConcurrentAccess is meant to be run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	starts := make([]time.Time, 6)
+	for i := range starts {
+		starts[i] = librarytest.AddProgram(t, source, librarytest.PastHour(i+3), "race", 3)
+	}
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	for _, start := range starts {
+		start := start
+		run(func() {
+			if _, err := l.Enqueue("TBS", start); err != nil {
+				t.Errorf("failed to enqueue: %v", err)
+			}
+		})
+	}
+	for i := 0; i < 3; i++ {
+		run(func() {
+			if _, err := l.List(); err != nil {
+				t.Errorf("failed to list: %v", err)
+			}
+		})
+		run(func() {
+			if _, err := l.Search(library.Query{Text: "race"}); err != nil {
+				t.Errorf("failed to search: %v", err)
+			}
+		})
+		run(func() {
+			if err := l.Load(); err != nil {
+				t.Errorf("failed to load: %v", err)
+			}
+		})
+	}
+	// the deletions may fail while the programs are being recorded
+	for _, start := range starts[:2] {
+		start := start
+		run(func() {
+			l.Delete("TBS", start)
+		})
+	}
+	wg.Wait()
+	librarytest.WaitJobs(t, l)
+
+	for _, start := range starts[2:] {
+		assertStatus(t, l, start, library.StatusReady)
+	}
+	recordings, err := l.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) < len(starts)-2 {
+		t.Errorf("listed %d recordings, want at least %d", len(recordings), len(starts)-2)
+	}
+}
@@ -0,0 +1,338 @@
+package library_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uphy/radiko-server/library"
+	"github.com/uphy/radiko-server/library/librarytest"
+)
+
+var location, _ = time.LoadLocation(library.TZ)
+
+func TestMain(m *testing.M) {
+	librarytest.Main(m)
+}
+
+func assertStatus(t *testing.T, l *library.Library, start time.Time, want string) {
+	t.Helper()
+	status, err := l.GetStatus("TBS", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != want {
+		t.Fatalf("status = %s (%s), want %s", status.Status, status.Error, want)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "荻上チキ・Session", 5)
+
+	job := librarytest.Record(t, l, start)
+	if job.State != library.JobSucceeded {
+		t.Fatalf("job state = %s, error = %s", job.State, job.Error)
+	}
+	assertStatus(t, l, start, library.StatusReady)
+
+	var want bytes.Buffer
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&want, "荻上チキ・Session chunk %d\n", i)
+	}
+	got, err := ioutil.ReadFile(l.AAC("TBS", start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("all.aac = %q, want %q", got, want.Bytes())
+	}
+	if _, err := os.Stat(l.MP3("TBS", start)); err != nil {
+		t.Errorf("mp3 is not produced: %v", err)
+	}
+
+	recordings, err := l.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 1 || recordings[0].Title != "荻上チキ・Session" {
+		t.Errorf("recordings = %+v", recordings)
+	}
+	page, err := l.Search(library.Query{Text: "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Recordings) != 1 {
+		t.Errorf("search returned %d recordings, want 1", len(page.Recordings))
+	}
+}
+
+func TestRecordResume(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "resume", 5)
+	// fail more than the retries of a job
+	source.Server.FailChunk("TBS", start, 2, 10)
+
+	job := librarytest.Record(t, l, start)
+	if job.State != library.JobFailed {
+		t.Fatalf("job state = %s, want %s", job.State, library.JobFailed)
+	}
+	assertStatus(t, l, start, library.StatusError)
+
+	source.Server.FailChunk("TBS", start, 2, 0)
+	retried, err := l.RetryJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := librarytest.WaitJob(t, l, retried.ID); job.State != library.JobSucceeded {
+		t.Fatalf("retried job state = %s, error = %s", job.State, job.Error)
+	}
+	assertStatus(t, l, start, library.StatusReady)
+	// the downloaded chunks are not downloaded again
+	for _, i := range []int{0, 1, 3, 4} {
+		if n := source.Server.Requests("TBS", start, i); n != 1 {
+			t.Errorf("chunk %d is requested %d times, want 1", i, n)
+		}
+	}
+}
+
+func TestCancelRecord(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "cancel", 40)
+	source.Server.DelayChunks("TBS", start, 200*time.Millisecond)
+
+	job, err := l.Enqueue("TBS", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for source.Server.Requests("TBS", start, 0) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := l.CancelJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := librarytest.WaitJob(t, l, job.ID); job.State != library.JobCanceled {
+		t.Fatalf("job state = %s, want %s", job.State, library.JobCanceled)
+	}
+	status, err := l.GetStatus("TBS", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the canceled recording is not resumed by the restart
+	if status.Status != library.StatusError {
+		t.Errorf("status of the canceled recording = %s, want %s", status.Status, library.StatusError)
+	}
+	// the chunks are downloaded concurrently up to 10 at a time
+	requested := 0
+	for i := 0; i < 40; i++ {
+		if source.Server.Requests("TBS", start, i) > 0 {
+			requested++
+		}
+	}
+	if requested == 40 {
+		t.Errorf("all the chunks are requested after the cancel")
+	}
+}
+
+func TestDeletedRecordingIsNotRecordedAgain(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "delete me", 3)
+	if _, err := l.RegisterKeyword(library.KeywordRule{Keyword: "delete"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ScanAndRecord(); err != nil {
+		t.Fatal(err)
+	}
+	librarytest.WaitJobs(t, l)
+	assertStatus(t, l, start, library.StatusReady)
+
+	if err := l.Delete("TBS", start); err != nil {
+		t.Fatal(err)
+	}
+	report, err := l.ScanAndRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Enqueued != 0 || report.Deleted != 1 {
+		t.Errorf("enqueued = %d, deleted = %d after the deletion", report.Enqueued, report.Deleted)
+	}
+
+	// recording by hand clears the tombstone
+	if job := librarytest.Record(t, l, start); job.State != library.JobSucceeded {
+		t.Fatalf("job state = %s, error = %s", job.State, job.Error)
+	}
+	report, err = l.ScanAndRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 0 {
+		t.Errorf("deleted = %d after recording by hand", report.Deleted)
+	}
+}
+
+func TestRecordNotReadyForTimeshift(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "not ready", 0)
+	if job := librarytest.Record(t, l, start); job.State != library.JobFailed {
+		t.Fatalf("job state = %s, want %s", job.State, library.JobFailed)
+	}
+	assertStatus(t, l, start, library.StatusError)
+}
+
+func TestRecordUnknownProgram(t *testing.T) {
+	l, _ := librarytest.NewLibrary(t)
+	start := librarytest.PastHour(3)
+	if job := librarytest.Record(t, l, start); job.State != library.JobFailed {
+		t.Fatalf("job state = %s, want %s", job.State, library.JobFailed)
+	}
+	if _, err := os.Stat(filepath.Dir(l.AAC("TBS", start))); !os.IsNotExist(err) {
+		t.Errorf("recording directory is left without the program: %v", err)
+	}
+}
+
+func TestEnqueueInvalidStation(t *testing.T) {
+	l, _ := librarytest.NewLibrary(t)
+	if _, err := l.Enqueue("..", librarytest.PastHour(3)); !errors.Is(err, library.ErrInvalidStation) {
+		t.Errorf("Enqueue: err = %v, want %v", err, library.ErrInvalidStation)
+	}
+	if _, err := l.EnqueueLive("../x", librarytest.PastHour(3)); !errors.Is(err, library.ErrInvalidStation) {
+		t.Errorf("EnqueueLive: err = %v, want %v", err, library.ErrInvalidStation)
+	}
+}
+
+func TestDeleteInvalidStation(t *testing.T) {
+	l, _ := librarytest.NewLibrary(t)
+	err := l.Delete("..", librarytest.PastHour(3))
+	if !errors.Is(err, library.ErrInvalidStation) {
+		t.Errorf("err = %v, want %v", err, library.ErrInvalidStation)
+	}
+}
+
+func TestRecordReadyRecordingKeepsFiles(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	profile := library.DefaultOutputProfile()
+	profile.KeepChunks = false
+	if err := l.SetOutputProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "no chunks", 3)
+	librarytest.Record(t, l, start)
+	assertStatus(t, l, start, library.StatusReady)
+	filesDir := filepath.Join(filepath.Dir(l.AAC("TBS", start)), "files")
+	if _, err := os.Stat(filesDir); !os.IsNotExist(err) {
+		t.Fatalf("chunk files are kept: %v", err)
+	}
+
+	// recording the ready program again doesn't create the chunk directory
+	librarytest.Record(t, l, start)
+	if _, err := os.Stat(filesDir); !os.IsNotExist(err) {
+		t.Errorf("chunk directory is created again: %v", err)
+	}
+	for _, format := range l.Formats("TBS", start) {
+		if format == library.FormatM3U8 {
+			t.Errorf("m3u8 is listed without the chunk files")
+		}
+	}
+}
+
+func TestRecordLiveResumedAfterEnd(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "live", 0)
+	// the chunks recorded before the restart
+	filesDir := filepath.Join(filepath.Dir(l.AAC("TBS", start)), "files")
+	if err := os.MkdirAll(filesDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	chunk := []byte("live chunk 0\n")
+	if err := ioutil.WriteFile(filepath.Join(filesDir, "20201231_230000_00000.aac"), chunk, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := l.EnqueueLive("TBS", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := librarytest.WaitJob(t, l, job.ID); job.State != library.JobSucceeded {
+		t.Fatalf("job state = %s, error = %s", job.State, job.Error)
+	}
+	assertStatus(t, l, start, library.StatusReady)
+	got, err := ioutil.ReadFile(l.AAC("TBS", start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, chunk) {
+		t.Errorf("all.aac = %q, want %q", got, chunk)
+	}
+
+	// nothing to finish without the chunks
+	ended := librarytest.AddProgram(t, source, librarytest.PastHour(5), "live", 0)
+	job, err = l.EnqueueLive("TBS", ended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := librarytest.WaitJob(t, l, job.ID); job.State != library.JobFailed {
+		t.Fatalf("job state = %s, want %s", job.State, library.JobFailed)
+	}
+	assertStatus(t, l, ended, library.StatusError)
+}
+
+// TestScanSchedulesInJST detects the schedules in the local time zone only when it is run outside JST.
+func TestScanSchedulesInJST(t *testing.T) {
+	l, _ := librarytest.NewLibrary(t)
+	if err := l.SetScanSchedules([]string{"30 5 * * *"}); err != nil {
+		t.Fatal(err)
+	}
+	next := l.SchedulerStatus().NextScan
+	if next == nil {
+		t.Fatal("the next scan is not scheduled")
+	}
+	if jst := next.In(location); jst.Hour() != 5 || jst.Minute() != 30 {
+		t.Errorf("next scan = %s, want 05:30 JST", jst)
+	}
+}
+
+func TestMigrateFollowsOutputProfile(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	profile := library.DefaultOutputProfile()
+	profile.AACContainer = library.AACContainerM4A
+	profile.MP3 = false
+	if err := l.SetOutputProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	start := librarytest.AddProgram(t, source, librarytest.PastHour(3), "migrate", 3)
+	librarytest.Record(t, l, start)
+	assertStatus(t, l, start, library.StatusReady)
+
+	m4a, err := l.AudioFile("TBS", start, library.FormatM4A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(m4a); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(m4a); err != nil {
+		t.Errorf("m4a is not produced: %v", err)
+	}
+	for _, file := range []string{l.AAC("TBS", start), l.MP3("TBS", start)} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s is produced against the profile: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+func TestParseProgramURLInvalidDate(t *testing.T) {
+	l, _ := librarytest.NewLibrary(t)
+	_, _, err := l.ParseProgramURL("https://radiko.jp/#!/ts/TBS/20201331230000")
+	var urlErr *library.URLError
+	if !errors.As(err, &urlErr) || urlErr.Reason != "invalid time" {
+		t.Errorf("err = %v, want the invalid time", err)
+	}
+}
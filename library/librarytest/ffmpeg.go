@@ -0,0 +1,46 @@
+package librarytest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fakeFFmpeg concatenates the files in the list of the concat demuxer, or copies the first input to the output.
+// The last argument is the output as the library passes.
+const fakeFFmpeg = `#!/bin/sh
+concat=
+input=
+output=
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-f)
+		[ "$2" = concat ] && concat=1
+		shift 2
+		;;
+	-i)
+		[ -z "$input" ] && input="$2"
+		shift 2
+		;;
+	*)
+		output="$1"
+		shift
+		;;
+	esac
+done
+if [ -n "$concat" ]; then
+	sed -n "s/^file '\(.*\)'$/\1/p" "$input" | while read -r f; do cat "$f"; done > "$output"
+else
+	cat "$input" > "$output"
+fi
+`
+
+// InstallFFmpeg puts the stand-in of ffmpeg in dir and prepends dir to PATH.
+// The stand-in doesn't convert the audio, but produces the output files so that the recordings become ready.
+// It is installed even if ffmpeg is installed, because the tests record text chunks which are not audio.
+func InstallFFmpeg(dir string) error {
+	if err := ioutil.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(fakeFFmpeg), 0755); err != nil {
+		return err
+	}
+	return os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
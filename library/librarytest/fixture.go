@@ -0,0 +1,113 @@
+package librarytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uphy/radiko-server/library"
+	"github.com/yyoshiki41/go-radiko"
+)
+
+// Main runs the tests with the ffmpeg stand-in.  Call it from TestMain.
+func Main(m *testing.M) {
+	dir, err := ioutil.TempDir("", "ffmpeg")
+	if err != nil {
+		panic(err)
+	}
+	if err := InstallFFmpeg(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// NewLibrary returns the loaded library in the temporary directory backed by the source with the station TBS.
+// They are closed by the cleanup of the test.
+func NewLibrary(t testing.TB) (*library.Library, *Source) {
+	t.Helper()
+	source := NewSource()
+	source.AddStation("TBS", "TBSラジオ")
+	l, err := library.NewWithSource(t.TempDir(), source)
+	if err != nil {
+		source.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+		source.Close()
+	})
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return l, source
+}
+
+// AddProgram registers the 1 hour program of TBS with n chunks and returns its start time.
+// The chunks are the texts "<title> chunk <i>\n".
+func AddProgram(t testing.TB, source *Source, start time.Time, title string, n int) time.Time {
+	t.Helper()
+	chunks := make([][]byte, n)
+	for i := range chunks {
+		chunks[i] = []byte(fmt.Sprintf("%s chunk %d\n", title, i))
+	}
+	prog := radiko.Prog{
+		Ft:    start.Format(library.DatetimeLayout),
+		To:    start.Add(time.Hour).Format(library.DatetimeLayout),
+		Title: title,
+	}
+	if err := source.AddProgram("TBS", prog, chunks...); err != nil {
+		t.Fatal(err)
+	}
+	return start
+}
+
+// PastHour returns the start of the hour n hours ago in JST.
+func PastHour(n int) time.Time {
+	location, _ := time.LoadLocation(library.TZ)
+	return time.Now().In(location).Truncate(time.Hour).Add(-time.Duration(n) * time.Hour)
+}
+
+// WaitJob waits for the job to finish and returns it.
+func WaitJob(t testing.TB, l *library.Library, id string) *library.Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := l.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch job.State {
+		case library.JobSucceeded, library.JobFailed, library.JobCanceled:
+			return job
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return nil
+}
+
+// WaitJobs waits for all the jobs to finish.
+func WaitJobs(t testing.TB, l *library.Library) {
+	t.Helper()
+	jobs, err := l.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		WaitJob(t, l, job.ID)
+	}
+}
+
+// Record enqueues the recording of the TBS program and waits for the job to finish.
+func Record(t testing.TB, l *library.Library, start time.Time) *library.Job {
+	t.Helper()
+	job, err := l.Enqueue("TBS", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WaitJob(t, l, job.ID)
+}
@@ -0,0 +1,214 @@
+package librarytest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ChunkDuration is the duration of the aac chunks served by the Server.
+	ChunkDuration = 5 * time.Second
+
+	chunkLayout = "20060102_150405"
+)
+
+type (
+	// Server is the local HTTP server which serves the timeshift playlists and the aac chunks like radiko.
+	Server struct {
+		server    *httptest.Server
+		mu        sync.Mutex
+		playlists map[string]*playlist
+	}
+
+	playlist struct {
+		// live playlists list the chunks available at the time
+		live      bool
+		createdAt time.Time
+		interval  time.Duration
+		names     []string
+		chunks    map[string][]byte
+		// failures is the number of the remaining failures of each chunk
+		failures map[string]int
+		// requests is the number of the requests of each chunk
+		requests map[string]int
+		delay    time.Duration
+	}
+)
+
+// NewServer starts the server.  Close must be called after use.
+func NewServer() *Server {
+	s := &Server{playlists: make(map[string]*playlist)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// AddPlaylist registers the chunks of the program and returns the URL of its media playlist.
+// The chunks are named after their start time as radiko does.  e.g. 20201231_230000_0.aac
+func (s *Server) AddPlaylist(stationID string, start time.Time, chunks ...[]byte) string {
+	p := &playlist{
+		chunks:   make(map[string][]byte),
+		failures: make(map[string]int),
+		requests: make(map[string]int),
+	}
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("%s_%d.aac", start.Add(time.Duration(i)*ChunkDuration).Format(chunkLayout), i)
+		p.names = append(p.names, name)
+		p.chunks[name] = chunk
+	}
+	key := playlistKey(stationID, start)
+	s.mu.Lock()
+	s.playlists[key] = p
+	s.mu.Unlock()
+	return s.server.URL + "/" + key + "/chunklist.m3u8"
+}
+
+// AddLivePlaylist registers the live stream of the station and returns the URL of its media playlist.
+// The index-th chunk appears in the playlist after index*interval, and the playlist lists the latest 3 chunks like the live stream.
+func (s *Server) AddLivePlaylist(stationID string, interval time.Duration, chunks ...[]byte) string {
+	p := &playlist{
+		live:      true,
+		createdAt: time.Now(),
+		interval:  interval,
+		chunks:    make(map[string][]byte),
+		failures:  make(map[string]int),
+		requests:  make(map[string]int),
+	}
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("live_%d.aac", i)
+		p.names = append(p.names, name)
+		p.chunks[name] = chunk
+	}
+	key := stationID + "/live"
+	s.mu.Lock()
+	s.playlists[key] = p
+	s.mu.Unlock()
+	return s.server.URL + "/" + key + "/chunklist.m3u8"
+}
+
+// FailChunk makes the server respond 500 for the index-th chunk of the program the given number of times.
+func (s *Server) FailChunk(stationID string, start time.Time, index int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.playlists[playlistKey(stationID, start)]
+	if !ok || index >= len(p.names) {
+		return
+	}
+	p.failures[p.names[index]] = times
+}
+
+// DelayChunks makes the server wait for the delay before responding each chunk of the program.
+func (s *Server) DelayChunks(stationID string, start time.Time, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.playlists[playlistKey(stationID, start)]; ok {
+		p.delay = delay
+	}
+}
+
+// Requests returns the number of the requests for the index-th chunk of the program, including the failed ones.
+func (s *Server) Requests(stationID string, start time.Time, index int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.playlists[playlistKey(stationID, start)]
+	if !ok || index >= len(p.names) {
+		return 0
+	}
+	return p.requests[p.names[index]]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// /<stationID>/<start>/<file>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	key, name := parts[0]+"/"+parts[1], parts[2]
+
+	s.mu.Lock()
+	p, ok := s.playlists[key]
+	if !ok {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	if name == "chunklist.m3u8" {
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		if p.live {
+			p.serveLive(w)
+			return
+		}
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:5\n#EXT-X-MEDIA-SEQUENCE:0\n")
+		for _, n := range p.names {
+			fmt.Fprintf(w, "#EXTINF:%d,\n%s/%s/%s\n", int(ChunkDuration.Seconds()), s.server.URL, key, n)
+		}
+		fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+		return
+	}
+	chunk, ok := p.chunks[name]
+	if !ok {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	p.requests[name]++
+	fail := p.failures[name] > 0
+	if fail {
+		p.failures[name]--
+	}
+	delay := p.delay
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fail {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/aac")
+	w.Write(chunk)
+}
+
+// serveLive writes the live playlist with the relative chunk URLs.
+func (p *playlist) serveLive(w http.ResponseWriter) {
+	available := int(time.Since(p.createdAt)/p.interval) + 1
+	if available > len(p.names) {
+		available = len(p.names)
+	}
+	from := available - 3
+	if from < 0 {
+		from = 0
+	}
+	duration := int(p.interval / time.Second)
+	if duration < 1 {
+		duration = 1
+	}
+	fmt.Fprintf(w, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n", duration, from)
+	for _, n := range p.names[from:available] {
+		fmt.Fprintf(w, "#EXTINF:%d,\n%s\n", duration, n)
+	}
+}
+
+func playlistKey(stationID string, start time.Time) string {
+	return stationID + "/" + start.Format("20060102150405")
+}
@@ -0,0 +1,227 @@
+// Package librarytest provides the in-memory program source and the local HTTP server
+// to test the library without accessing radiko.
+package librarytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uphy/radiko-server/library"
+	"github.com/yyoshiki41/go-radiko"
+)
+
+// ErrProgramNotFound is returned by the Source if the program is not registered.
+var ErrProgramNotFound = errors.New("program not found")
+
+// DefaultAreaID is the area detected by the Source unless SetAreaID is called.
+const DefaultAreaID = "JP13"
+
+type (
+	// Source is the in-memory library.ProgramSource.
+	// Timeshift playlists of the programs registered with chunks are served by its Server.
+	Source struct {
+		Server   *Server
+		location *time.Location
+		mu       sync.Mutex
+		areaID   string
+		stations []radiko.Station
+		// areas is the areas of each station
+		areas map[string][]string
+		progs map[string][]radiko.Prog
+		errs  map[string]error
+		lives map[string]string
+	}
+)
+
+var _ library.ProgramSource = (*Source)(nil)
+
+// NewSource returns the empty source with the started Server.  Close must be called after use.
+func NewSource() *Source {
+	location, _ := time.LoadLocation(library.TZ)
+	return &Source{
+		Server:   NewServer(),
+		location: location,
+		areaID:   DefaultAreaID,
+		areas:    make(map[string][]string),
+		progs:    make(map[string][]radiko.Prog),
+		errs:     make(map[string]error),
+		lives:    make(map[string]string),
+	}
+}
+
+// Close shuts down the Server.
+func (s *Source) Close() {
+	s.Server.Close()
+}
+
+// AddStation registers the station in the detected area.
+func (s *Source) AddStation(id, name string) {
+	s.AddAreaStation(DefaultAreaID, id, name)
+}
+
+// AddAreaStation registers the station in the area.  The station may be registered in multiple areas.
+func (s *Source) AddAreaStation(areaID, id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.station(id); !ok {
+		s.stations = append(s.stations, radiko.Station{ID: id, Name: name})
+	}
+	s.areas[id] = append(s.areas[id], areaID)
+}
+
+// SetAreaID changes the detected area.
+func (s *Source) SetAreaID(areaID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.areaID = areaID
+}
+
+// AddProgram registers the program of the station.
+// If chunks are given, the program is available for the timeshift play.
+func (s *Source) AddProgram(stationID string, prog radiko.Prog, chunks ...[]byte) error {
+	start, err := time.ParseInLocation(library.DatetimeLayout, prog.Ft, s.location)
+	if err != nil {
+		return err
+	}
+	if _, err := time.ParseInLocation(library.DatetimeLayout, prog.To, s.location); err != nil {
+		return err
+	}
+	if len(chunks) > 0 {
+		s.Server.AddPlaylist(stationID, start, chunks...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	progs := append(s.progs[stationID], prog)
+	sort.Slice(progs, func(i, j int) bool {
+		return progs[i].Ft < progs[j].Ft
+	})
+	s.progs[stationID] = progs
+	return nil
+}
+
+// AddLive starts the live stream of the station.  See Server.AddLivePlaylist.
+func (s *Source) AddLive(stationID string, interval time.Duration, chunks ...[]byte) {
+	uri := s.Server.AddLivePlaylist(stationID, interval, chunks...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lives[stationID] = uri
+}
+
+// SetError makes all the requests for the station fail with err.  nil clears the error.
+func (s *Source) SetError(stationID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, stationID)
+	} else {
+		s.errs[stationID] = err
+	}
+}
+
+// AreaID returns the detected area.
+func (s *Source) AreaID(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.areaID, nil
+}
+
+// GetStations returns the stations of the area with the programs starting on the date.
+func (s *Source) GetStations(ctx context.Context, areaID string, date time.Time) (radiko.Stations, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(areaID) == 0 {
+		areaID = s.areaID
+	}
+	day := date.In(s.location).Format("20060102")
+	stations := make(radiko.Stations, 0, len(s.stations))
+	for _, station := range s.stations {
+		if !containsString(s.areas[station.ID], areaID) {
+			continue
+		}
+		station.Progs = radiko.Progs{Date: day}
+		for _, prog := range s.progs[station.ID] {
+			if prog.Ft[:8] == day {
+				station.Progs.Progs = append(station.Progs.Progs, prog)
+			}
+		}
+		stations = append(stations, station)
+	}
+	return stations, nil
+}
+
+// GetWeeklyPrograms returns all the programs of the station.
+func (s *Source) GetWeeklyPrograms(ctx context.Context, stationID string) (radiko.Stations, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.errs[stationID]; err != nil {
+		return nil, err
+	}
+	station, ok := s.station(stationID)
+	if !ok {
+		return nil, fmt.Errorf("station not found: stationID=%s", stationID)
+	}
+	station.Progs = radiko.Progs{Progs: append([]radiko.Prog(nil), s.progs[stationID]...)}
+	return radiko.Stations{station}, nil
+}
+
+// GetProgramByStartTime returns the program starting at start.
+func (s *Source) GetProgramByStartTime(ctx context.Context, stationID string, start time.Time) (*radiko.Prog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.errs[stationID]; err != nil {
+		return nil, err
+	}
+	ft := start.In(s.location).Format(library.DatetimeLayout)
+	for _, prog := range s.progs[stationID] {
+		if prog.Ft == ft {
+			p := prog
+			return &p, nil
+		}
+	}
+	return nil, ErrProgramNotFound
+}
+
+// TimeshiftPlaylistM3U8 returns the URL of the playlist served by the Server.
+func (s *Source) TimeshiftPlaylistM3U8(ctx context.Context, stationID string, start time.Time) (string, error) {
+	if _, err := s.GetProgramByStartTime(ctx, stationID, start); err != nil {
+		return "", err
+	}
+	return s.Server.URL() + "/" + playlistKey(stationID, start.In(s.location)) + "/chunklist.m3u8", nil
+}
+
+// LivePlaylistM3U8 returns the URL of the live playlist served by the Server.
+func (s *Source) LivePlaylistM3U8(ctx context.Context, stationID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.errs[stationID]; err != nil {
+		return "", err
+	}
+	uri, ok := s.lives[stationID]
+	if !ok {
+		return "", fmt.Errorf("station is not on the air: stationID=%s", stationID)
+	}
+	return uri, nil
+}
+
+func (s *Source) station(id string) (radiko.Station, bool) {
+	for _, station := range s.stations {
+		if station.ID == id {
+			return station, true
+		}
+	}
+	return radiko.Station{}, false
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
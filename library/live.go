@@ -0,0 +1,243 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// liveLeadTime is how early the live recording starts before the program.
+	liveLeadTime = 30 * time.Second
+	// liveMargin is how long the live recording continues after the program end.
+	liveMargin = time.Minute
+	// defaultLivePollInterval is used if the live playlist doesn't have the target duration.
+	defaultLivePollInterval = 5 * time.Second
+	// maxLivePlaylistFailures is the number of the consecutive failures to get the live playlist to give up.
+	maxLivePlaylistFailures = 12
+	// liveRequestTimeout limits each request of the live recording so that a stalled request doesn't stop the polling.
+	liveRequestTimeout = 30 * time.Second
+)
+
+var ErrProgramEnded = errors.New("program has already ended")
+
+// EnqueueLive schedules the live recording of the program at its start time.
+// It is for the stations and the programs which are not available for the timeshift play.
+// It returns ErrInvalidStation or ErrStationOutOfArea as Enqueue.
+func (l *Library) EnqueueLive(stationID string, start time.Time) (*Job, error) {
+	if err := validateStation(stationID); err != nil {
+		return nil, err
+	}
+	if err := l.checkReachable(stationID); err != nil {
+		return nil, err
+	}
+	l.undelete(stationID, start)
+	job, err := l.enqueueLive(stationID, start, "")
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (l *Library) enqueueLive(stationID string, start time.Time, ruleID string) (Job, error) {
+	scheduledAt := start.Add(-liveLeadTime)
+	return l.jobs.enqueue(jobRequest{
+		stationID:   stationID,
+		start:       start,
+		ruleID:      ruleID,
+		live:        true,
+		scheduledAt: &scheduledAt,
+	})
+}
+
+// recordLive records the program from the live stream until its end.
+// The chunks are written to the recording directory as the timeshift recording.
+func (l *Library) recordLive(ctx context.Context, stationID string, start time.Time, ruleID string) error {
+	dir := l.recordingDirectory(stationID, start)
+	if dir.ready() {
+		log.Infof("Already recorded: stationID=%s, start=%s", stationID, start)
+		return nil
+	}
+	// created after the check not to recreate the chunk directory removed after the conversion
+	dir.create()
+
+	detail, err := l.saveProgram(ctx, dir, stationID, start, ruleID, true)
+	if err != nil {
+		l.fail(dir, err)
+		return err
+	}
+	if !time.Now().Before(detail.End) {
+		// the recording resumed after the end keeps the chunks recorded before the restart
+		if chunks, _ := completedChunks(dir.filesDir()); len(chunks) > 0 {
+			log.Warnf("Finish the partial live recording: stationID=%s, start=%s, chunks=%d", stationID, start, len(chunks))
+			return l.finish(ctx, dir, ruleID)
+		}
+		err = fmt.Errorf("%w: stationID=%s, start=%s", ErrProgramEnded, stationID, start)
+	} else {
+		err = l.followLive(ctx, dir, stationID, start, detail.End.Add(liveMargin))
+	}
+	if err != nil {
+		l.fail(dir, fmt.Errorf("Failed to record live stream: %w", err))
+		return err
+	}
+	return l.finish(ctx, dir, ruleID)
+}
+
+// followLive downloads the new chunks of the live playlist until the time.
+// Chunks are named with the time they appeared and the sequence number, e.g. 20201231_230000_00001.aac,
+// so that they are sorted in the order of the stream.
+func (l *Library) followLive(ctx context.Context, dir *recordingDirectory, stationID string, start, until time.Time) error {
+	existing, err := completedChunks(dir.filesDir())
+	if err != nil {
+		return err
+	}
+	// the requests are bounded by the end of the recording as well as the job
+	liveCtx, cancel := context.WithDeadline(ctx, until)
+	defer cancel()
+	// continue the sequence of the chunks recorded before the restart
+	seq := len(existing)
+	downloaded := 0
+	seen := make(map[string]bool)
+	failures := 0
+	var uri string
+	for time.Now().Before(until) {
+		interval := defaultLivePollInterval
+		reqCtx, cancelReq := context.WithTimeout(liveCtx, liveRequestTimeout)
+		if len(uri) == 0 {
+			uri, err = l.source.LivePlaylistM3U8(reqCtx, stationID)
+		}
+		var chunks []string
+		if err == nil {
+			chunks, interval, err = fetchLiveChunklist(reqCtx, uri)
+		}
+		cancelReq()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if liveCtx.Err() != nil {
+				break
+			}
+			failures++
+			log.Warnf("Failed to get live playlist: stationID=%s, failures=%d, err=%v", stationID, failures, err)
+			if failures >= maxLivePlaylistFailures {
+				return fmt.Errorf("Failed to get live playlist: %w", err)
+			}
+			// the playlist url may be expired
+			uri = ""
+			interval = defaultLivePollInterval
+		} else {
+			failures = 0
+			for _, chunk := range chunks {
+				if seen[chunk] {
+					continue
+				}
+				seen[chunk] = true
+				name := fmt.Sprintf("%s_%05d.aac", time.Now().In(l.location).Format(chunkTimeLayout), seq)
+				seq++
+				if err := retry(liveCtx, func() error {
+					reqCtx, cancelReq := context.WithTimeout(liveCtx, liveRequestTimeout)
+					defer cancelReq()
+					return downloadFile(reqCtx, chunk, filepath.Join(dir.filesDir(), name))
+				}); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					if liveCtx.Err() != nil {
+						break
+					}
+					// the gap is tolerated because the stream can't be downloaded again
+					log.Errorf("Failed to download live chunk: stationID=%s, url=%s, err=%v", stationID, chunk, err)
+					continue
+				}
+				downloaded++
+			}
+			progress := float32(time.Since(start)) / float32(until.Sub(start))
+			if progress < 0 {
+				progress = 0
+			}
+			dir.updateStatus(&Status{
+				Status:           StatusDownloading,
+				DownloadProgress: progress,
+			}, false)
+		}
+
+		select {
+		case <-liveCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		case <-time.After(interval):
+		}
+	}
+	if downloaded == 0 && len(existing) == 0 {
+		return errors.New("No live chunks were downloaded")
+	}
+	return nil
+}
+
+// fetchLiveChunklist returns the absolute URLs of the segments in the live media playlist and the interval to poll it.
+func fetchLiveChunklist(ctx context.Context, uri string) ([]string, time.Duration, error) {
+	playlist, err := fetchPlaylist(ctx, uri, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	media, ok := playlist.(*m3u8.MediaPlaylist)
+	if !ok {
+		return nil, 0, fmt.Errorf("not a media playlist: url=%s", uri)
+	}
+	base, err := url.Parse(uri)
+	if err != nil {
+		return nil, 0, err
+	}
+	chunks := make([]string, 0, len(media.Segments))
+	for _, segment := range media.Segments {
+		if segment == nil {
+			continue
+		}
+		u, err := base.Parse(segment.URI)
+		if err != nil {
+			return nil, 0, err
+		}
+		chunks = append(chunks, u.String())
+	}
+	interval := defaultLivePollInterval
+	if media.TargetDuration > 0 {
+		interval = time.Duration(media.TargetDuration * float64(time.Second))
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return chunks, interval, nil
+}
+
+// fetchPlaylist fetches and decodes the m3u8 playlist.
+func fetchPlaylist(ctx context.Context, uri string, header http.Header) (m3u8.Playlist, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: url=%s, status=%s", uri, resp.Status)
+	}
+	playlist, _, err := m3u8.DecodeFrom(resp.Body, true)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode m3u8: url=%s, err=%w", uri, err)
+	}
+	return playlist, nil
+}
@@ -0,0 +1,58 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// liveSource serves only the live playlist.
+type liveSource struct {
+	ProgramSource
+	uri string
+}
+
+func (s *liveSource) LivePlaylistM3U8(ctx context.Context, stationID string) (string, error) {
+	return s.uri, nil
+}
+
+func TestFollowLiveStalledRequests(t *testing.T) {
+	for _, stalled := range []string{"/chunklist.m3u8", "/chunk.aac"} {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == stalled {
+				// never respond until the client gives up
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+				return
+			}
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nchunk.aac\n")
+		}))
+
+		location, _ := time.LoadLocation(TZ)
+		l := &Library{location: location, source: &liveSource{uri: server.URL + "/chunklist.m3u8"}}
+		dir := &recordingDirectory{dir: t.TempDir()}
+		if err := os.Mkdir(filepath.Join(dir.dir, "files"), 0777); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		done := make(chan error, 1)
+		go func() {
+			done <- l.followLive(context.Background(), dir, "TBS", start, start.Add(time.Second))
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Errorf("stalled %s keeps the live recording after its end", stalled)
+		}
+		close(release)
+		server.Close()
+	}
+}
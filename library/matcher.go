@@ -0,0 +1,58 @@
+package library
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// matcher tests if the text contains the term.
+type matcher interface {
+	match(text string) bool
+}
+
+// normalizedMatcher matches the term ignoring the differences of full/half width, case, and hiragana/katakana.
+type normalizedMatcher struct {
+	term string
+}
+
+func newNormalizedMatcher(term string) *normalizedMatcher {
+	return &normalizedMatcher{normalize(term)}
+}
+
+func (m *normalizedMatcher) match(text string) bool {
+	return strings.Contains(normalize(text), m.term)
+}
+
+// regexpMatcher matches the regular expression case insensitively.
+// The expression is tested against both of the original and the normalized text.
+type regexpMatcher struct {
+	r *regexp.Regexp
+}
+
+func newRegexpMatcher(expr string) (*regexpMatcher, error) {
+	r, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	return &regexpMatcher{r}, nil
+}
+
+func (m *regexpMatcher) match(text string) bool {
+	return m.r.MatchString(text) || m.r.MatchString(normalize(text))
+}
+
+// normalize converts the text to NFKC, lower case and hiragana.
+//
+// e.g. "ＡＢＣラジオ" -> "abcらじお"
+func normalize(s string) string {
+	s = strings.ToLower(norm.NFKC.String(s))
+	return strings.Map(func(r rune) rune {
+		// katakana (ァ-ヶ) to hiragana (ぁ-ゖ)
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 'ァ' + 'ぁ'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,130 @@
+package library
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yyoshiki41/go-radiko"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ＡＮＮ", "ann"},
+		{"オールナイトニッポン", "おーるないとにっぽん"},
+		{"ｵｰﾙﾅｲﾄﾆｯﾎﾟﾝ", "おーるないとにっぽん"},
+		{"ＴＢＳラジオ　ＪＵＮＫ", "tbsらじお junk"},
+		{"アフター６ジャンクション", "あふたー6じゃんくしょん"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.in); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizedMatcher(t *testing.T) {
+	tests := []struct {
+		term, text string
+		want       bool
+	}{
+		// full/half width and case
+		{"ann", "オードリーのオールナイトニッポン（ＡＮＮ）", true},
+		{"ＡＮＮ", "オールナイトニッポン0(ZERO) ann0", true},
+		{"JUNK", "ＪＵＮＫ 爆笑問題カーボーイ", true},
+		// half-width katakana
+		{"オールナイトニッポン", "ｵｰﾙﾅｲﾄﾆｯﾎﾟﾝ GOLD", true},
+		{"ｼﾞｬﾝｸ", "アフター6ジャンクション2", true},
+		// hiragana/katakana folding
+		{"らじお", "ＴＢＳラジオ 荻上チキ・Session", true},
+		{"にっぽん放送", "ニッポン放送 ショウアップナイター", true},
+		{"問題", "爆笑問題カーボーイ", true},
+		{"ann", "伊集院光 深夜の馬鹿力", false},
+		{"カーボーイ", "JUNK 伊集院光・深夜の馬鹿力", false},
+	}
+	for _, tt := range tests {
+		if got := newNormalizedMatcher(tt.term).match(tt.text); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.term, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRegexpMatcher(t *testing.T) {
+	tests := []struct {
+		expr, text string
+		want       bool
+	}{
+		{`^オードリー`, "オードリーのオールナイトニッポン", true},
+		{`^オードリー`, "ナイツ ザ・ラジオショー", false},
+		{`ann0?$`, "佐久間宣行のANN0", true},
+		// case insensitive
+		{`junk`, "JUNK バナナマンのバナナムーンGOLD", true},
+		// tested against the normalized text too
+		{`ann`, "オールナイトニッポン（ＡＮＮ）", true},
+		{`ジャンク|junk`, "アフター６ジャンクション", true},
+		{`深夜の(馬鹿力|バカ力)`, "伊集院光 深夜の馬鹿力", true},
+	}
+	for _, tt := range tests {
+		m, err := newRegexpMatcher(tt.expr)
+		if err != nil {
+			t.Fatalf("newRegexpMatcher(%q): %v", tt.expr, err)
+		}
+		if got := m.match(tt.text); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.expr, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordRuleMatch(t *testing.T) {
+	location, _ := time.LoadLocation(TZ)
+	start := time.Date(2020, 12, 31, 25, 0, 0, 0, location)
+	end := start.Add(2 * time.Hour)
+	prog := &radiko.Prog{
+		Title: "オードリーのオールナイトニッポン",
+		Pfm:   "オードリー(若林正恭、春日俊彰)",
+		Desc:  "ＡＮＮ 再放送はありません",
+		Info:  "番組へのメールはann@allnightnippon.com",
+	}
+	tests := []struct {
+		name string
+		rule KeywordRule
+		want bool
+	}{
+		{"keyword", KeywordRule{Keyword: "ｵｰﾙﾅｲﾄ"}, true},
+		{"performer", KeywordRule{Keyword: "かすが"}, false},
+		{"performer kanji", KeywordRule{Keyword: "春日俊彰"}, true},
+		{"regexp", KeywordRule{Keyword: `^オードリー.*ニッポン$`, Regexp: true}, true},
+		{"regexp not matched", KeywordRule{Keyword: `^ナイツ`, Regexp: true}, false},
+		{"exclude", KeywordRule{Keyword: "オードリー", Exclude: []string{"再放送"}}, false},
+		{"exclude normalized", KeywordRule{Keyword: "オードリー", Exclude: []string{"ＡＬＬＮＩＧＨＴＮＩＰＰＯＮ．ＣＯＭ"}}, false},
+		{"exclude not matched", KeywordRule{Keyword: "オードリー", Exclude: []string{"傑作選"}}, true},
+		{"station", KeywordRule{Keyword: "オードリー", Stations: []string{"TBS"}}, false},
+		{"weekday", KeywordRule{Keyword: "オードリー", Weekdays: []string{"fri"}}, true},
+		{"start time across midnight", KeywordRule{Keyword: "オードリー", StartFrom: "23:00", StartTo: "02:00"}, true},
+		{"min duration", KeywordRule{Keyword: "オードリー", MinDuration: 150}, false},
+	}
+	for _, tt := range tests {
+		rule := tt.rule
+		if err := rule.validate(); err != nil {
+			t.Fatalf("%s: validate: %v", tt.name, err)
+		}
+		if got := rule.match("LFR", prog, start, end); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeywordRuleValidate(t *testing.T) {
+	for _, rule := range []KeywordRule{
+		{Keyword: "ab"},
+		{Keyword: "(unclosed", Regexp: true},
+		{Keyword: "オードリー", Weekdays: []string{"someday"}},
+		{Keyword: "オードリー", StartFrom: "25:00"},
+		{Keyword: "オードリー", Exclude: []string{" "}},
+	} {
+		if err := rule.validate(); err == nil {
+			t.Errorf("validate(%+v) = nil, want error", rule)
+		}
+	}
+}
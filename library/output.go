@@ -0,0 +1,307 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	FormatM3U8 = "m3u8"
+	FormatAAC  = "aac"
+	FormatM4A  = "m4a"
+	FormatMP3  = "mp3"
+	FormatOpus = "opus"
+	FormatFLAC = "flac"
+
+	AACContainerADTS = "adts"
+	AACContainerM4A  = "m4a"
+	AACContainerNone = "none"
+)
+
+// audioFormats is the list of the audio file formats in the order of preference.
+var audioFormats = []string{FormatM4A, FormatMP3, FormatAAC, FormatOpus, FormatFLAC}
+
+// lazyFormats are produced on the first request if the recording doesn't have them.
+var lazyFormats = []string{FormatM4A, FormatOpus}
+
+// OutputProfile decides the audio files produced by the recording.
+type OutputProfile struct {
+	// KeepChunks keeps the downloaded chunk files used by the m3u8 playlist.
+	KeepChunks bool `json:"keepChunks"`
+	// AACContainer is the container of the AAC file without re-encoding.
+	// "adts" (all.aac), "m4a" (all.m4a) or "none".  Empty means "adts".
+	AACContainer string `json:"aacContainer,omitempty"`
+	// MP3 produces all.mp3.  MP3Bitrate is in kbps and zero means VBR (-q:a 2).
+	MP3        bool `json:"mp3"`
+	MP3Bitrate int  `json:"mp3Bitrate,omitempty"`
+	// Opus produces all.opus.  OpusBitrate is in kbps and zero means 64kbps.
+	Opus        bool `json:"opus"`
+	OpusBitrate int  `json:"opusBitrate,omitempty"`
+	// FLAC produces all.flac.
+	FLAC bool `json:"flac"`
+}
+
+// DefaultOutputProfile returns the profile which produces the chunk files, all.aac and all.mp3.
+func DefaultOutputProfile() OutputProfile {
+	return OutputProfile{
+		KeepChunks:   true,
+		AACContainer: AACContainerADTS,
+		MP3:          true,
+	}
+}
+
+func (p *OutputProfile) validate() error {
+	switch p.AACContainer {
+	case "", AACContainerADTS, AACContainerM4A, AACContainerNone:
+	default:
+		return fmt.Errorf("unknown aac container: %s", p.AACContainer)
+	}
+	if p.MP3Bitrate < 0 || p.OpusBitrate < 0 {
+		return fmt.Errorf("negative bitrate")
+	}
+	if !p.KeepChunks && p.AACContainer == AACContainerNone && !p.MP3 && !p.Opus && !p.FLAC {
+		return fmt.Errorf("no output")
+	}
+	return nil
+}
+
+// formats returns the audio formats produced by the profile.
+func (p *OutputProfile) formats() []string {
+	formats := make([]string, 0)
+	switch p.AACContainer {
+	case "", AACContainerADTS:
+		formats = append(formats, FormatAAC)
+	case AACContainerM4A:
+		formats = append(formats, FormatM4A)
+	}
+	if p.MP3 {
+		formats = append(formats, FormatMP3)
+	}
+	if p.Opus {
+		formats = append(formats, FormatOpus)
+	}
+	if p.FLAC {
+		formats = append(formats, FormatFLAC)
+	}
+	return formats
+}
+
+// SetOutputProfile sets the default output profile of the recordings.
+// KeywordRule.Output overrides it.
+func (l *Library) SetOutputProfile(profile OutputProfile) error {
+	if err := profile.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.output = profile
+	return nil
+}
+
+// outputProfile returns the output profile for the recording of the keyword rule.
+func (l *Library) outputProfile(ruleID string) OutputProfile {
+	if rule, err := l.keywords.get(ruleID); err == nil && rule.Output != nil {
+		return *rule.Output
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.output
+}
+
+// convert produces the audio files from the downloaded chunk files.
+func (l *Library) convert(ctx context.Context, dir *recordingDirectory, profile OutputProfile) error {
+	// Concat aac files
+	concatedFile, err := ConcatAACFilesFromList(ctx, dir.filesDir())
+	if err != nil {
+		return fmt.Errorf("Failed to concat aac files: %w", err)
+	}
+	defer os.Remove(concatedFile)
+
+	switch profile.AACContainer {
+	case "", AACContainerADTS:
+		os.Remove(dir.aacFile())
+		if err := os.Rename(concatedFile, dir.aacFile()); err != nil {
+			return fmt.Errorf("Failed to rename aac: %w", err)
+		}
+		concatedFile = dir.aacFile()
+	case AACContainerM4A:
+		if err := produce(dir.audioFile(FormatM4A), func(output string) error {
+			return RemuxAACtoM4A(ctx, concatedFile, output)
+		}); err != nil {
+			return fmt.Errorf("Failed to remux aac to m4a: %w", err)
+		}
+	}
+	if profile.MP3 {
+		if err := produce(dir.mp3File(), func(output string) error {
+			return ConvertAACtoMP3(ctx, concatedFile, output, profile.MP3Bitrate)
+		}); err != nil {
+			return fmt.Errorf("Failed to convert aac to mp3: %w", err)
+		}
+	}
+	if profile.Opus {
+		if err := produce(dir.audioFile(FormatOpus), func(output string) error {
+			return ConvertAACtoOpus(ctx, concatedFile, output, profile.OpusBitrate)
+		}); err != nil {
+			return fmt.Errorf("Failed to convert aac to opus: %w", err)
+		}
+	}
+	if profile.FLAC {
+		if err := produce(dir.audioFile(FormatFLAC), func(output string) error {
+			return ConvertAACtoFLAC(ctx, concatedFile, output)
+		}); err != nil {
+			return fmt.Errorf("Failed to convert aac to flac: %w", err)
+		}
+	}
+	if !profile.KeepChunks {
+		if err := os.RemoveAll(dir.filesDir()); err != nil {
+			return fmt.Errorf("Failed to remove chunk files: %w", err)
+		}
+	}
+	l.retag(ctx, dir)
+	return nil
+}
+
+// produce generates the output file removing the incomplete file on failure.
+func produce(output string, f func(output string) error) error {
+	os.Remove(output)
+	if err := f(output); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+// Formats returns the available formats of the recording.
+// It includes the formats which will be produced on the first request.
+func (l *Library) Formats(stationID string, start time.Time) []string {
+	dir := l.recordingDirectory(stationID, start)
+	formats := make([]string, 0)
+	if _, err := os.Stat(dir.filesDir()); err == nil {
+		formats = append(formats, FormatM3U8)
+	}
+	lazy := dir.ready() && len(l.sourceFile(dir)) > 0
+	for _, format := range audioFormats {
+		if _, err := os.Stat(dir.audioFile(format)); err == nil || (lazy && containsString(lazyFormats, format)) {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// AudioFile returns the path of the audio file of the format.
+// m4a and opus files are produced from the recorded aac on the first request and cached.
+// It returns ErrFormatNotFound if the recording doesn't have the format.
+func (l *Library) AudioFile(stationID string, start time.Time, format string) (string, error) {
+	if !containsString(audioFormats, format) {
+		return "", ErrFormatNotFound
+	}
+	dir := l.recordingDirectory(stationID, start)
+	file := dir.audioFile(format)
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	if !containsString(lazyFormats, format) || !dir.ready() {
+		return "", ErrFormatNotFound
+	}
+
+	// produce the file only once even if requested concurrently.
+	// the lock is per recording because the chunk files are concatenated to the same temporary file.
+	unlock := l.fileLocks.lock(dir.dir)
+	defer unlock()
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	source := l.sourceFile(dir)
+	if len(source) == 0 {
+		return "", ErrFormatNotFound
+	}
+	if source == dir.filesDir() {
+		concatedFile, err := ConcatAACFilesFromList(l.ctx, dir.filesDir())
+		if err != nil {
+			return "", fmt.Errorf("Failed to concat aac files: %w", err)
+		}
+		defer os.Remove(concatedFile)
+		source = concatedFile
+	}
+	log.Infof("Producing audio file: stationID=%s, start=%s, format=%s", stationID, start, format)
+	if err := produce(file, func(output string) error {
+		switch format {
+		case FormatM4A:
+			return RemuxAACtoM4A(l.ctx, source, output)
+		default:
+			return ConvertAACtoOpus(l.ctx, source, output, l.outputProfile("").OpusBitrate)
+		}
+	}); err != nil {
+		return "", fmt.Errorf("Failed to produce %s: %w", format, err)
+	}
+	l.tag(l.ctx, dir, format)
+	return file, nil
+}
+
+// podcastFormats are the formats listed in the podcast feeds.
+var podcastFormats = []string{FormatMP3, FormatM4A}
+
+// preparePodcast produces m4a if the ready recording has none of the podcast formats.
+// The feeds need the size of the file, so it is produced after the recording instead of on the request of the feed.
+func (l *Library) preparePodcast(dir *recordingDirectory) {
+	for _, format := range podcastFormats {
+		if _, err := os.Stat(dir.audioFile(format)); err == nil {
+			return
+		}
+	}
+	detail, err := dir.loadDetail()
+	if err != nil {
+		return
+	}
+	if _, err := l.AudioFile(detail.StationID, detail.Start, FormatM4A); err != nil {
+		log.Warnf("Failed to produce m4a for the podcast feeds: stationID=%s, start=%s, err=%v", detail.StationID, detail.Start, err)
+	}
+}
+
+// AudioFileSize returns the size of the audio file of the format.
+// It returns zero if the file is not produced yet.
+func (l *Library) AudioFileSize(stationID string, start time.Time, format string) int64 {
+	info, err := os.Stat(l.recordingDirectory(stationID, start).audioFile(format))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// sourceFile returns the aac source to produce other formats.
+// It is an aac file, a m4a file or the chunk files directory.  Empty if there is no source.
+func (l *Library) sourceFile(dir *recordingDirectory) string {
+	for _, file := range []string{dir.aacFile(), dir.audioFile(FormatM4A), dir.filesDir()} {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// fileLocks is a set of the locks by file name.
+type fileLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (f *fileLocks) lock(name string) func() {
+	f.mu.Lock()
+	if f.locks == nil {
+		f.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := f.locks[name]
+	if !ok {
+		m = new(sync.Mutex)
+		f.locks[name] = m
+	}
+	f.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
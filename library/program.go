@@ -0,0 +1,67 @@
+package library
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+const weeklyProgramsURL = "https://radiko.jp/v3/program/station/weekly/%s.xml"
+
+type (
+	// programExtras is the program metadata which go-radiko doesn't provide.
+	programExtras struct {
+		Ft    string `xml:"ft,attr"`
+		Pfm   string `xml:"pfm"`
+		Img   string `xml:"img"`
+		Genre struct {
+			Program struct {
+				Name string `xml:"name"`
+			} `xml:"program"`
+			Personality struct {
+				Name string `xml:"name"`
+			} `xml:"personality"`
+		} `xml:"genre"`
+	}
+	weeklyProgramsData struct {
+		Stations []struct {
+			ID    string `xml:"id,attr"`
+			Progs []struct {
+				Progs []programExtras `xml:"prog"`
+			} `xml:"progs"`
+		} `xml:"stations>station"`
+	}
+)
+
+// fetchProgramExtras fetches the image and the genre of the program from the weekly program guide.
+// Only the programs within the weekly guide are available.
+func fetchProgramExtras(ctx context.Context, stationID string, ft string) (*programExtras, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(weeklyProgramsURL, stationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: stationID=%s, status=%s", stationID, resp.Status)
+	}
+
+	var d weeklyProgramsData
+	if err := xml.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	for _, station := range d.Stations {
+		for _, progs := range station.Progs {
+			for _, prog := range progs.Progs {
+				if prog.Ft == ft {
+					return &prog, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("program not found in the weekly guide: stationID=%s, ft=%s", stationID, ft)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -20,6 +21,12 @@ type (
 		StationID string    `json:"stationId"`
 		Start     time.Time `json:"start"`
 		End       time.Time `json:"end"`
+		// RuleID is the ID of the keyword rule which matched the program.
+		RuleID string `json:"ruleId,omitempty"`
+		// Pinned recordings are never pruned by the retention policy.
+		Pinned bool `json:"pinned,omitempty"`
+		// Live is true if the program is recorded from the live stream.
+		Live bool `json:"live,omitempty"`
 	}
 	RecordingDetail struct {
 		Recording
@@ -27,6 +34,11 @@ type (
 		Subtitle    string `json:"subtitle"`
 		URL         string `json:"url"`
 		Info        string `json:"info"`
+		Performer   string `json:"performer,omitempty"`
+		Image       string `json:"image,omitempty"`
+		Genre       string `json:"genre,omitempty"`
+		StationName string `json:"stationName,omitempty"`
+		StationLogo string `json:"stationLogo,omitempty"`
 	}
 
 	Status struct {
@@ -35,8 +47,12 @@ type (
 		Error            string  `json:"error,omitempty"`
 	}
 	recordingDirectory struct {
-		dir              string
+		dir string
+		// mu guards nextStatusUpdate and the status file.  The status is updated by the download goroutines.
+		mu               sync.Mutex
 		nextStatusUpdate *time.Time
+		// onStatus is called when the status is saved
+		onStatus func(status *Status)
 	}
 )
 
@@ -75,6 +91,8 @@ func (l *recordingDirectory) loadStatus() (*Status, error) {
 }
 
 func (l *recordingDirectory) updateStatus(status *Status, force bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	t := time.Now()
 	if !force && l.nextStatusUpdate != nil && l.nextStatusUpdate.After(t) {
 		return nil
@@ -86,6 +104,9 @@ func (l *recordingDirectory) updateStatus(status *Status, force bool) error {
 }
 
 func (l *recordingDirectory) saveStatus(status *Status) error {
+	if l.onStatus != nil {
+		l.onStatus(status)
+	}
 	return l.saveJSON(filepath.Join(l.dir, "status.json"), status)
 }
 
@@ -112,11 +133,15 @@ func (l *recordingDirectory) filesDir() string {
 }
 
 func (l *recordingDirectory) aacFile() string {
-	return filepath.Join(l.dir, "all.aac")
+	return l.audioFile(FormatAAC)
 }
 
 func (l *recordingDirectory) mp3File() string {
-	return filepath.Join(l.dir, "all.mp3")
+	return l.audioFile(FormatMP3)
+}
+
+func (l *recordingDirectory) audioFile(format string) string {
+	return filepath.Join(l.dir, "all."+format)
 }
 
 func (l *recordingDirectory) ready() bool {
@@ -0,0 +1,167 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Retention is the policy to prune old recordings.
+// Zero values disable the corresponding limits.  Pinned recordings are never pruned.
+type Retention struct {
+	// KeepPerKeyword is the number of the latest episodes to keep for each keyword rule.
+	// KeywordRule.Keep overrides it.
+	KeepPerKeyword int
+	// MaxAge is the maximum age of the recordings from the program start.
+	MaxAge time.Duration
+	// MaxTotalSize is the maximum total size of the recordings in bytes.
+	MaxTotalSize int64
+}
+
+// SetRetention sets the retention policy used by Sweep.
+func (l *Library) SetRetention(retention Retention) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retention = retention
+}
+
+// Sweep deletes the recordings exceeding the retention policy.
+// The pruned programs are not recorded again by the scans.
+func (l *Library) Sweep() error {
+	l.mu.RLock()
+	retention := l.retention
+	l.mu.RUnlock()
+
+	recordings, err := l.List()
+	if err != nil {
+		return err
+	}
+	// only finished and not pinned recordings are the candidates
+	candidates := make([]Recording, 0, len(recordings))
+	// ready has the index keys of the ready recordings
+	ready := make(map[string]bool)
+	for _, recording := range recordings {
+		if recording.Pinned {
+			continue
+		}
+		status, err := l.GetStatus(recording.StationID, recording.Start)
+		if err != nil || (status.Status != StatusReady && status.Status != StatusError) {
+			continue
+		}
+		candidates = append(candidates, recording)
+		ready[indexKey(recording.StationID, recording.Start)] = status.Status == StatusReady
+	}
+	// the newest first
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Start.After(candidates[j].Start)
+	})
+
+	deleted := make(map[*Recording]bool)
+	deleteRecording := func(recording *Recording, reason string) {
+		if deleted[recording] {
+			return
+		}
+		log.Infof("Deleting recording by retention policy: stationID=%s, start=%s, title=%s, reason=%s", recording.StationID, recording.Start, recording.Title, reason)
+		if err := l.delete(recording.StationID, recording.Start, DeletedByRetention); err != nil {
+			if !errors.Is(err, ErrRecordingBusy) {
+				log.Errorf("Failed to delete recording: %v", err)
+			}
+			return
+		}
+		deleted[recording] = true
+	}
+
+	// keep the latest episodes per keyword rule.  the failed recordings are left to the retries of the scans.
+	counts := make(map[string]int)
+	for i := range candidates {
+		recording := &candidates[i]
+		if len(recording.RuleID) == 0 || !ready[indexKey(recording.StationID, recording.Start)] {
+			continue
+		}
+		keep := retention.KeepPerKeyword
+		if rule, err := l.keywords.get(recording.RuleID); err == nil && rule.Keep > 0 {
+			keep = rule.Keep
+		}
+		counts[recording.RuleID]++
+		if keep > 0 && counts[recording.RuleID] > keep {
+			deleteRecording(recording, "keep")
+		}
+	}
+
+	// max age
+	if retention.MaxAge > 0 {
+		limit := time.Now().Add(-retention.MaxAge)
+		for i := range candidates {
+			if candidates[i].Start.Before(limit) {
+				deleteRecording(&candidates[i], "max age")
+			}
+		}
+	}
+
+	// max total size, including the recordings which are not candidates
+	if retention.MaxTotalSize > 0 {
+		var total int64
+		sizes := make(map[*Recording]int64)
+		for _, recording := range recordings {
+			total += dirSize(l.recordingDirectory(recording.StationID, recording.Start).dir)
+		}
+		for i := range candidates {
+			if deleted[&candidates[i]] {
+				continue
+			}
+			sizes[&candidates[i]] = dirSize(l.recordingDirectory(candidates[i].StationID, candidates[i].Start).dir)
+		}
+		// delete from the oldest
+		for i := len(candidates) - 1; i >= 0 && total > retention.MaxTotalSize; i-- {
+			recording := &candidates[i]
+			if deleted[recording] {
+				continue
+			}
+			deleteRecording(recording, "max total size")
+			if deleted[recording] {
+				total -= sizes[recording]
+			}
+		}
+	}
+	return nil
+}
+
+// Pin sets the pinned flag of the recording.
+func (l *Library) Pin(stationID string, start time.Time, pinned bool) error {
+	dir := l.recordingDirectory(stationID, start)
+	detail, err := dir.loadDetail()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrRecordingNotFound
+		}
+		return err
+	}
+	detail.Pinned = pinned
+	if err := dir.saveDetail(detail); err != nil {
+		return err
+	}
+	status, err := dir.loadStatus()
+	if err != nil {
+		return err
+	}
+	if err := l.store.putRecording(detail, status); err != nil {
+		return err
+	}
+	l.index.setPinned(stationID, start, pinned)
+	return nil
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
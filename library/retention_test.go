@@ -0,0 +1,44 @@
+package library_test
+
+import (
+	"testing"
+
+	"github.com/uphy/radiko-server/library"
+	"github.com/uphy/radiko-server/library/librarytest"
+)
+
+func TestSweepKeepsReadyEpisodes(t *testing.T) {
+	l, source := librarytest.NewLibrary(t)
+	oldest := librarytest.AddProgram(t, source, librarytest.PastHour(5), "daily show", 2)
+	older := librarytest.AddProgram(t, source, librarytest.PastHour(4), "daily show", 2)
+	// the newest episode fails to be downloaded
+	newest := librarytest.AddProgram(t, source, librarytest.PastHour(3), "daily show", 2)
+	source.Server.FailChunk("TBS", newest, 1, 10)
+	if _, err := l.RegisterKeyword(library.KeywordRule{Keyword: "daily", Keep: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ScanAndRecord(); err != nil {
+		t.Fatal(err)
+	}
+	librarytest.WaitJobs(t, l)
+	assertStatus(t, l, newest, library.StatusError)
+
+	if err := l.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	// the failed episode doesn't count, so the latest ready one is kept
+	assertStatus(t, l, older, library.StatusReady)
+	assertStatus(t, l, newest, library.StatusError)
+	if _, err := l.GetStatus("TBS", oldest); err == nil {
+		t.Errorf("the oldest episode is not pruned")
+	}
+
+	// the pruned episode is not recorded again, and the failed one is backed off
+	report, err := l.ScanAndRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Enqueued != 0 || report.Deleted != 1 || len(report.BackedOff) != 1 {
+		t.Errorf("enqueued = %d, deleted = %d, backed off = %d", report.Enqueued, report.Deleted, len(report.BackedOff))
+	}
+}
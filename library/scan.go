@@ -0,0 +1,431 @@
+package library
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/yyoshiki41/go-radiko"
+)
+
+const (
+	MatchRecorded = "RECORDED"
+	MatchPending  = "PENDING"
+	MatchFailed   = "FAILED"
+	MatchUpcoming = "UPCOMING"
+	// MatchUnreachable is the program of the station outside the detected area.
+	MatchUnreachable = "UNREACHABLE"
+	// MatchDeleted is the program whose recording has been deleted.  It is not recorded again by the scans.
+	MatchDeleted = "DELETED"
+)
+
+const (
+	ScanStageStations = "STATIONS"
+	ScanStageGuide    = "GUIDE"
+	ScanStageProgram  = "PROGRAM"
+	ScanStageRecord   = "RECORD"
+)
+
+type (
+	// MatchedProgram is the program in the weekly guide matched by the keyword rule.
+	MatchedProgram struct {
+		StationID string    `json:"stationId"`
+		Start     time.Time `json:"start"`
+		End       time.Time `json:"end"`
+		Title     string    `json:"title"`
+		Performer string    `json:"performer,omitempty"`
+		RuleID    string    `json:"ruleId"`
+		Keyword   string    `json:"keyword"`
+		State     string    `json:"state"`
+		JobID     string    `json:"jobId,omitempty"`
+		Error     string    `json:"error,omitempty"`
+	}
+
+	// KeywordPreview is the result of evaluating the keyword rules against the weekly guide.
+	// Past has the finished programs and Future has the programs not finished yet.
+	KeywordPreview struct {
+		Past   []MatchedProgram `json:"past"`
+		Future []MatchedProgram `json:"future"`
+		Errors []ScanError      `json:"errors"`
+	}
+
+	// ScanReport is the result of the scan.
+	// The scan continues on the errors of the stations and the programs, and they are reported in Errors.
+	ScanReport struct {
+		StartedAt  time.Time `json:"startedAt"`
+		FinishedAt time.Time `json:"finishedAt"`
+		// Stations is the number of the stations whose weekly guides are scanned.
+		Stations int `json:"stations"`
+		Matched  int `json:"matched"`
+		Enqueued int `json:"enqueued"`
+		Planned  int `json:"planned"`
+		// Deleted is the number of the matched programs skipped because their recordings have been deleted.
+		Deleted int `json:"deleted"`
+		// BackedOff has the matched programs which failed to be recorded before.
+		BackedOff []BackedOffProgram `json:"backedOff"`
+		Errors    []ScanError        `json:"errors"`
+	}
+
+	// ScanError is the error of the scan.  Stage is one of ScanStage*.
+	ScanError struct {
+		Stage     string `json:"stage"`
+		AreaID    string `json:"areaId,omitempty"`
+		StationID string `json:"stationId,omitempty"`
+		Program   string `json:"program,omitempty"`
+		Title     string `json:"title,omitempty"`
+		Error     string `json:"error"`
+	}
+
+	// BackedOffProgram is the program whose recording is delayed or given up by the failures.
+	// RetryAt is nil if the scan gave up the program.
+	BackedOffProgram struct {
+		StationID   string     `json:"stationId"`
+		Start       time.Time  `json:"start"`
+		Title       string     `json:"title"`
+		RuleID      string     `json:"ruleId"`
+		Failures    int        `json:"failures"`
+		LastFailure time.Time  `json:"lastFailure"`
+		RetryAt     *time.Time `json:"retryAt,omitempty"`
+		Error       string     `json:"error"`
+	}
+
+	// programMatch is the program matched by the rule.
+	// The program is unreachable if the station is outside the detected area.
+	programMatch struct {
+		stationID   string
+		prog        radiko.Prog
+		start       time.Time
+		end         time.Time
+		rule        *KeywordRule
+		unreachable error
+	}
+)
+
+func newScanReport() *ScanReport {
+	return &ScanReport{
+		StartedAt: time.Now(),
+		BackedOff: make([]BackedOffProgram, 0),
+		Errors:    make([]ScanError, 0),
+	}
+}
+
+func (r *ScanReport) addError(e ScanError) {
+	log.Warnf("Scan error: stage=%s, stationID=%s, program=%s, err=%s", e.Stage, e.StationID, e.Program, e.Error)
+	r.Errors = append(r.Errors, e)
+}
+
+// failedStations returns the stations whose weekly guides couldn't be scanned.
+func (r *ScanReport) failedStations() map[string]bool {
+	stations := make(map[string]bool)
+	for _, e := range r.Errors {
+		if e.Stage == ScanStageGuide {
+			stations[e.StationID] = true
+		}
+	}
+	return stations
+}
+
+// matchPrograms calls fn with the programs in the cached weekly guides which match the rules.
+// The guides of the detected area, the configured areas and the areas of the rules are scanned.
+// The first matching rule is used if the program matches multiple rules.
+// The errors of the areas, the stations, the programs and fn are added to the report and the scan continues,
+// and the error is returned only if the stations of the detected area are not available.
+func (l *Library) matchPrograms(rules []KeywordRule, report *ScanReport, fn func(m *programMatch) error) error {
+	detected, err := l.source.AreaID(l.ctx)
+	if err != nil {
+		err = fmt.Errorf("Failed to detect area: %w", err)
+		report.addError(ScanError{Stage: ScanStageStations, Error: err.Error()})
+		return err
+	}
+	libraryAreas := l.libraryAreas(detected)
+	areas := libraryAreas
+	for _, rule := range rules {
+		for _, area := range rule.Areas {
+			areas = appendArea(areas, area)
+		}
+	}
+	stations, errs := l.listStations(areas)
+	for _, area := range areas {
+		if err := errs[area]; err != nil {
+			err = fmt.Errorf("Failed to get stations: %w", err)
+			report.addError(ScanError{Stage: ScanStageStations, AreaID: area, Error: err.Error()})
+			if area == detected {
+				// the reachable stations are unknown
+				return err
+			}
+		}
+	}
+
+	for _, station := range stations {
+		stationID := station.ID
+		var unreachable error
+		if !containsString(station.areas, detected) {
+			unreachable = fmt.Errorf("%w: stationID=%s is in %s, but the reachable area is %s",
+				ErrStationOutOfArea, stationID, strings.Join(station.areas, ","), detected)
+		}
+		log.Infof("Getting weekly programs: stationID=%s", stationID)
+		programs, err := l.guides.weekly(l.ctx, stationID)
+		if err != nil {
+			report.addError(ScanError{
+				Stage:     ScanStageGuide,
+				StationID: stationID,
+				Error:     fmt.Sprintf("Failed to get weekly programs: %v", err),
+			})
+			continue
+		}
+		report.Stations++
+		for _, program := range programs {
+			for _, prog := range program.Progs.Progs {
+				programEnd, err := l.ParseTime(prog.To)
+				if err != nil {
+					report.addError(ScanError{
+						Stage:     ScanStageProgram,
+						StationID: stationID,
+						Program:   prog.Ft,
+						Title:     prog.Title,
+						Error:     fmt.Sprintf("Failed to parse program end time: %v", err),
+					})
+					continue
+				}
+				programStart, err := l.ParseTime(prog.Ft)
+				if err != nil {
+					report.addError(ScanError{
+						Stage:     ScanStageProgram,
+						StationID: stationID,
+						Program:   prog.Ft,
+						Title:     prog.Title,
+						Error:     fmt.Sprintf("Failed to parse program start time: %v", err),
+					})
+					continue
+				}
+
+				// Check if the program match with the keyword rules
+				var matched *KeywordRule
+				for i := range rules {
+					if !rules[i].matchArea(station.areas, libraryAreas) {
+						continue
+					}
+					if rules[i].match(stationID, &prog, programStart, programEnd) {
+						matched = &rules[i]
+						break
+					}
+				}
+				if matched == nil {
+					continue
+				}
+				report.Matched++
+				if err := fn(&programMatch{
+					stationID:   stationID,
+					prog:        prog,
+					start:       programStart,
+					end:         programEnd,
+					rule:        matched,
+					unreachable: unreachable,
+				}); err != nil {
+					report.addError(ScanError{
+						Stage:     ScanStageRecord,
+						StationID: stationID,
+						Program:   prog.Ft,
+						Title:     prog.Title,
+						Error:     err.Error(),
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ScanAndRecord matches the keyword rules against the weekly guides.
+// The finished programs are enqueued to record, and the others are planned to be enqueued by the scheduler
+// shortly after their end, or before their start for the live recording.
+// The programs which failed to be recorded are retried with the backoff, and given up after maxRecordFailures.
+// The report is returned even if the error is returned, and kept as the last report of the scheduler.
+func (l *Library) ScanAndRecord() (*ScanReport, error) {
+	l.scheduler.scanMu.Lock()
+	defer l.scheduler.scanMu.Unlock()
+
+	report := newScanReport()
+	err := l.scanAndRecord(report)
+	report.FinishedAt = time.Now()
+	l.scheduler.setReport(report, err)
+	return report, err
+}
+
+func (l *Library) scanAndRecord(report *ScanReport) error {
+	rules := l.keywords.list()
+	plan := make([]PlannedRecording, 0)
+	if len(rules) == 0 {
+		l.scheduler.setPlan(plan)
+		return nil
+	}
+
+	now := time.Now()
+	delay := l.scheduler.delay()
+	err := l.matchPrograms(rules, report, func(m *programMatch) error {
+		p := PlannedRecording{
+			StationID: m.stationID,
+			Start:     m.start,
+			End:       m.end,
+			Title:     m.prog.Title,
+			RuleID:    m.rule.ID,
+			Keyword:   m.rule.Keyword,
+			Live:      m.rule.Live,
+			At:        m.end.Add(delay),
+		}
+		if p.Live {
+			// live rules record the programs not finished yet from the live stream
+			if !m.end.After(now) {
+				return nil
+			}
+			p.At = m.start.Add(-liveLeadTime)
+		}
+		if l.recordingDirectory(m.stationID, m.start).ready() {
+			return nil
+		}
+		deleted, err := l.deleted(m.stationID, m.start)
+		if err != nil {
+			return fmt.Errorf("Failed to load the tombstone: %w", err)
+		}
+		if deleted {
+			report.Deleted++
+			return nil
+		}
+		if m.unreachable != nil {
+			return m.unreachable
+		}
+		if !p.Live {
+			failure, err := l.store.failure(m.stationID, m.start)
+			if err != nil {
+				return fmt.Errorf("Failed to load the recording failures: %w", err)
+			}
+			if failure != nil {
+				backedOff := BackedOffProgram{
+					StationID:   m.stationID,
+					Start:       m.start,
+					Title:       m.prog.Title,
+					RuleID:      m.rule.ID,
+					Failures:    failure.Failures,
+					LastFailure: failure.LastFailure,
+					Error:       failure.Error,
+				}
+				retryAt := failure.retryAt()
+				if !retryAt.IsZero() {
+					backedOff.RetryAt = &retryAt
+				}
+				report.BackedOff = append(report.BackedOff, backedOff)
+				if retryAt.IsZero() {
+					return nil
+				}
+				if retryAt.After(p.At) {
+					p.At = retryAt
+				}
+			}
+		}
+		if p.At.After(now) {
+			plan = append(plan, p)
+			report.Planned++
+			return nil
+		}
+		if err := l.enqueuePlanned(&p); err != nil {
+			return fmt.Errorf("Failed to enqueue: %w", err)
+		}
+		report.Enqueued++
+		return nil
+	})
+	if err != nil {
+		// the plan is kept because the scan is incomplete
+		return err
+	}
+	// the planned recordings of the stations which couldn't be scanned are kept until the next scan
+	if failed := report.failedStations(); len(failed) > 0 {
+		plan = append(plan, l.scheduler.planned(failed)...)
+	}
+	l.scheduler.setPlan(plan)
+	return nil
+}
+
+// PreviewKeywords evaluates the keyword rules against the weekly guide without recording.
+// If ruleID is not empty, only the rule is evaluated.
+func (l *Library) PreviewKeywords(ruleID string) (*KeywordPreview, error) {
+	rules := l.keywords.list()
+	if len(ruleID) > 0 {
+		rule, err := l.keywords.get(ruleID)
+		if err != nil {
+			return nil, err
+		}
+		rules = []KeywordRule{*rule}
+	}
+
+	preview := &KeywordPreview{
+		Past:   make([]MatchedProgram, 0),
+		Future: make([]MatchedProgram, 0),
+		Errors: make([]ScanError, 0),
+	}
+	if len(rules) == 0 {
+		return preview, nil
+	}
+	now := time.Now()
+	report := newScanReport()
+	err := l.matchPrograms(rules, report, func(m *programMatch) error {
+		p := MatchedProgram{
+			StationID: m.stationID,
+			Start:     m.start,
+			End:       m.end,
+			Title:     m.prog.Title,
+			Performer: m.prog.Pfm,
+			RuleID:    m.rule.ID,
+			Keyword:   m.rule.Keyword,
+		}
+		switch {
+		case m.unreachable != nil:
+			p.State = MatchUnreachable
+			p.Error = m.unreachable.Error()
+		case m.end.After(now):
+			p.State = MatchUpcoming
+		default:
+			l.fillMatchState(&p)
+		}
+		if m.end.After(now) {
+			preview.Future = append(preview.Future, p)
+		} else {
+			preview.Past = append(preview.Past, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	preview.Errors = report.Errors
+	return preview, nil
+}
+
+// fillMatchState sets the recording state of the finished program.
+// Programs which are not recorded yet are pending because they are recorded by the next scan.
+func (l *Library) fillMatchState(p *MatchedProgram) {
+	dir := l.recordingDirectory(p.StationID, p.Start)
+	if dir.ready() {
+		p.State = MatchRecorded
+		return
+	}
+	if deleted, err := l.deleted(p.StationID, p.Start); err == nil && deleted {
+		p.State = MatchDeleted
+		return
+	}
+	p.State = MatchPending
+	if job, ok := l.jobs.latest(p.StationID, p.Start); ok {
+		p.JobID = job.ID
+		if job.State == JobFailed {
+			p.State = MatchFailed
+			p.Error = job.Error
+		}
+		if job.State == JobQueued || job.State == JobRunning {
+			return
+		}
+	}
+	if status, err := dir.loadStatus(); err == nil && status.Status == StatusError {
+		p.State = MatchFailed
+		p.Error = status.Error
+	}
+}
@@ -0,0 +1,333 @@
+package library
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// DefaultRecordDelay is the delay from the program end to the recording.
+	// The program becomes available for the timeshift play a few minutes after its end.
+	DefaultRecordDelay = 10 * time.Minute
+	// DefaultScanSchedule is the cron schedule to scan the programs.
+	DefaultScanSchedule = "0 * * * *"
+)
+
+type (
+	// PlannedRecording is the matched program to be recorded later.
+	PlannedRecording struct {
+		StationID string    `json:"stationId"`
+		Start     time.Time `json:"start"`
+		End       time.Time `json:"end"`
+		Title     string    `json:"title"`
+		RuleID    string    `json:"ruleId"`
+		Keyword   string    `json:"keyword"`
+		Live      bool      `json:"live,omitempty"`
+		// At is the time to enqueue the recording job.
+		// It is shortly after the program end, or before the program start for the live recording.
+		At time.Time `json:"at"`
+	}
+
+	// SchedulerStatus is the state of the scheduler.
+	SchedulerStatus struct {
+		Running       bool               `json:"running"`
+		Schedules     []string           `json:"schedules"`
+		RecordDelay   string             `json:"recordDelay"`
+		LastScan      *time.Time         `json:"lastScan,omitempty"`
+		LastScanError string             `json:"lastScanError,omitempty"`
+		NextScan      *time.Time         `json:"nextScan,omitempty"`
+		Planned       []PlannedRecording `json:"planned"`
+	}
+
+	// scheduler triggers the recordings of the planned programs and the scans by the cron schedules.
+	// The plan is rebuilt by every scan, and the keyword rule changes request the scan.
+	scheduler struct {
+		// mu guards the fields except scanMu
+		mu            sync.Mutex
+		schedules     []*cronSchedule
+		recordDelay   time.Duration
+		plan          []PlannedRecording
+		lastScan      *time.Time
+		lastScanError string
+		lastReport    *ScanReport
+		nextScan      *time.Time
+		running       bool
+		rescan        bool
+		wake          chan struct{}
+		stop          chan struct{}
+		done          chan struct{}
+		// scanMu serializes the scans
+		scanMu sync.Mutex
+	}
+)
+
+func newScheduler() *scheduler {
+	schedule, _ := parseCron(DefaultScanSchedule)
+	return &scheduler{
+		schedules:   []*cronSchedule{schedule},
+		recordDelay: DefaultRecordDelay,
+		plan:        make([]PlannedRecording, 0),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// SetScanSchedules sets the cron schedules to scan the programs, e.g. "0 */6 * * *".
+// The schedules are evaluated in JST as the program guides regardless of the time zone of the server.
+// The recordings of the matched programs are triggered by their end time regardless of the schedules,
+// so the scans are needed only to catch up with the changes of the program guides.
+func (l *Library) SetScanSchedules(specs []string) error {
+	schedules := make([]*cronSchedule, 0, len(specs))
+	for _, spec := range specs {
+		schedule, err := parseCron(spec)
+		if err != nil {
+			return err
+		}
+		schedules = append(schedules, schedule)
+	}
+	s := l.scheduler
+	s.mu.Lock()
+	s.schedules = schedules
+	s.nextScan = s.nextScheduledScan(time.Now().In(l.location))
+	s.mu.Unlock()
+	s.notify()
+	return nil
+}
+
+// SetRecordDelay sets the delay from the program end to the recording.
+func (l *Library) SetRecordDelay(delay time.Duration) {
+	s := l.scheduler
+	s.mu.Lock()
+	s.recordDelay = delay
+	s.mu.Unlock()
+	s.requestScan()
+}
+
+// StartScheduler starts the scheduler.  It scans the programs immediately.
+func (l *Library) StartScheduler() {
+	s := l.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.rescan = true
+	go l.runScheduler()
+	s.notify()
+}
+
+// SchedulerStatus returns the state of the scheduler and the planned recordings sorted by the time.
+func (l *Library) SchedulerStatus() *SchedulerStatus {
+	s := l.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &SchedulerStatus{
+		Running:       s.running,
+		Schedules:     make([]string, 0, len(s.schedules)),
+		RecordDelay:   s.recordDelay.String(),
+		LastScan:      s.lastScan,
+		LastScanError: s.lastScanError,
+		NextScan:      s.nextScan,
+		Planned:       append([]PlannedRecording{}, s.plan...),
+	}
+	for _, schedule := range s.schedules {
+		status.Schedules = append(status.Schedules, schedule.String())
+	}
+	return status
+}
+
+func (l *Library) runScheduler() {
+	s := l.scheduler
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		rescan := s.rescan
+		s.rescan = false
+		s.mu.Unlock()
+		if rescan {
+			l.scan()
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if next := s.nextWakeup(); !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			expired = timer.C
+		}
+		select {
+		case <-s.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		now := time.Now()
+		for _, p := range s.due(now) {
+			if err := l.enqueuePlanned(&p); err != nil {
+				log.Errorf("Failed to enqueue the planned recording: stationID=%s, start=%s, err=%v", p.StationID, p.Start, err)
+			}
+		}
+		s.mu.Lock()
+		if s.nextScan != nil && !now.Before(*s.nextScan) {
+			s.rescan = true
+		}
+		s.mu.Unlock()
+	}
+}
+
+// LastScanReport returns the report of the last scan, or nil if the programs haven't been scanned yet.
+func (l *Library) LastScanReport() *ScanReport {
+	s := l.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastReport
+}
+
+// scan scans the programs and updates the time of the next scan.
+func (l *Library) scan() {
+	log.Infof("Scanning programs for recording...")
+	report, err := l.ScanAndRecord()
+	if err != nil {
+		log.Errorf("Failed to record: %v", err)
+	} else {
+		log.Infof("Successfully scan programs for recording: stations=%d, matched=%d, enqueued=%d, planned=%d, backedOff=%d, errors=%d",
+			report.Stations, report.Matched, report.Enqueued, report.Planned, len(report.BackedOff), len(report.Errors))
+	}
+	s := l.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextScan = s.nextScheduledScan(time.Now().In(l.location))
+}
+
+// enqueuePlanned adds the recording job of the planned program.
+func (l *Library) enqueuePlanned(p *PlannedRecording) error {
+	if p.Live {
+		log.Infof("Enqueue live recording: stationID=%s, start=%s, title=%s, keyword=%s", p.StationID, p.Start, p.Title, p.Keyword)
+		_, err := l.enqueueLive(p.StationID, p.Start, p.RuleID)
+		return err
+	}
+	log.Infof("Enqueue program: stationID=%s, start=%s, title=%s, keyword=%s", p.StationID, p.Start, p.Title, p.Keyword)
+	_, err := l.jobs.enqueue(jobRequest{stationID: p.StationID, start: p.Start, ruleID: p.RuleID})
+	return err
+}
+
+// setPlan replaces the planned recordings.
+func (s *scheduler) setPlan(plan []PlannedRecording) {
+	sort.SliceStable(plan, func(i, j int) bool {
+		return plan[i].At.Before(plan[j].At)
+	})
+	s.mu.Lock()
+	s.plan = plan
+	s.mu.Unlock()
+	s.notify()
+}
+
+// setReport records the result of the scan.
+func (s *scheduler) setReport(report *ScanReport, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastScan = &report.FinishedAt
+	s.lastScanError = ""
+	if err != nil {
+		s.lastScanError = err.Error()
+	}
+	s.lastReport = report
+}
+
+// planned returns the planned recordings of the stations.
+func (s *scheduler) planned(stations map[string]bool) []PlannedRecording {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plan := make([]PlannedRecording, 0)
+	for _, p := range s.plan {
+		if stations[p.StationID] {
+			plan = append(plan, p)
+		}
+	}
+	return plan
+}
+
+// due removes and returns the planned recordings whose time has come.
+func (s *scheduler) due(now time.Time) []PlannedRecording {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := 0
+	for i < len(s.plan) && !now.Before(s.plan[i].At) {
+		i++
+	}
+	due := s.plan[:i]
+	s.plan = append([]PlannedRecording{}, s.plan[i:]...)
+	return due
+}
+
+// nextWakeup returns the earliest time of the planned recordings and the next scan.
+func (s *scheduler) nextWakeup() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	if len(s.plan) > 0 {
+		next = s.plan[0].At
+	}
+	if s.nextScan != nil && (next.IsZero() || s.nextScan.Before(next)) {
+		next = *s.nextScan
+	}
+	return next
+}
+
+// nextScheduledScan returns the earliest time of the schedules after now.
+// The schedules are evaluated in the location of now.  s.mu must be held.
+func (s *scheduler) nextScheduledScan(now time.Time) *time.Time {
+	var next *time.Time
+	for _, schedule := range s.schedules {
+		t := schedule.next(now)
+		if !t.IsZero() && (next == nil || t.Before(*next)) {
+			next = &t
+		}
+	}
+	return next
+}
+
+func (s *scheduler) delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recordDelay
+}
+
+// requestScan requests the scheduler to scan the programs, e.g. after the keyword rules are changed.
+func (s *scheduler) requestScan() {
+	s.mu.Lock()
+	s.rescan = true
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify wakes up the scheduler to reflect the changes.
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the scheduler and waits for it.
+func (s *scheduler) close() {
+	s.mu.Lock()
+	running := s.running
+	s.running = false
+	s.mu.Unlock()
+	if running {
+		close(s.stop)
+		<-s.done
+	}
+}
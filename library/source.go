@@ -0,0 +1,152 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/yyoshiki41/go-radiko"
+)
+
+const (
+	clientRefreshInterval = 5 * time.Minute
+	livePlaylistURL       = "https://f-radiko.smartstream.ne.jp/%s/_definst_/simul-stream.stream/playlist.m3u8"
+)
+
+type (
+	// ProgramSource provides the program guide and the playlists of the stations.
+	// AreaID returns the area detected from the IP address, e.g. "JP13".  Only the stations in the area can be played.
+	// GetStations returns the stations of the area, or of the detected area if areaID is empty.
+	// TimeshiftPlaylistM3U8 returns the URL of the media playlist which lists the absolute URLs of the aac chunks.
+	// LivePlaylistM3U8 returns the URL of the live media playlist which is updated as the stream proceeds.
+	ProgramSource interface {
+		AreaID(ctx context.Context) (string, error)
+		GetStations(ctx context.Context, areaID string, date time.Time) (radiko.Stations, error)
+		GetWeeklyPrograms(ctx context.Context, stationID string) (radiko.Stations, error)
+		GetProgramByStartTime(ctx context.Context, stationID string, start time.Time) (*radiko.Prog, error)
+		TimeshiftPlaylistM3U8(ctx context.Context, stationID string, start time.Time) (string, error)
+		LivePlaylistM3U8(ctx context.Context, stationID string) (string, error)
+	}
+
+	// programExtrasSource is implemented by the sources which provide the metadata go-radiko doesn't.
+	programExtrasSource interface {
+		programExtras(ctx context.Context, stationID string, ft string) (*programExtras, error)
+	}
+
+	// radikoSource is the ProgramSource backed by go-radiko.
+	radikoSource struct {
+		// mu guards client and lastUpdate
+		mu         sync.Mutex
+		client     *radiko.Client
+		lastUpdate time.Time
+	}
+)
+
+// NewRadikoSource returns the ProgramSource which fetches the programs from radiko.
+func NewRadikoSource() (ProgramSource, error) {
+	s := &radikoSource{}
+	if _, err := s.radikoClient(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// radikoClient returns the radiko client, refreshing it every 5 minutes to renew the auth token.
+// The client is replaced instead of modified because it is used by other goroutines.
+func (s *radikoSource) radikoClient() (*radiko.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil && time.Now().Before(s.lastUpdate.Add(clientRefreshInterval)) {
+		return s.client, nil
+	}
+
+	client, err := radiko.New("")
+	if err != nil {
+		return nil, err
+	}
+	client.AuthorizeToken(context.Background())
+	s.client = client
+	s.lastUpdate = time.Now()
+	return client, nil
+}
+
+func (s *radikoSource) AreaID(ctx context.Context) (string, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return "", err
+	}
+	return client.AreaID(), nil
+}
+
+func (s *radikoSource) GetStations(ctx context.Context, areaID string, date time.Time) (radiko.Stations, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return nil, err
+	}
+	if len(areaID) > 0 && areaID != client.AreaID() {
+		// the guides of other areas are public, so the copy of the client only changes the area
+		c := *client
+		c.SetAreaID(areaID)
+		client = &c
+	}
+	return client.GetStations(ctx, date)
+}
+
+func (s *radikoSource) GetWeeklyPrograms(ctx context.Context, stationID string) (radiko.Stations, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetWeeklyPrograms(ctx, stationID)
+}
+
+func (s *radikoSource) GetProgramByStartTime(ctx context.Context, stationID string, start time.Time) (*radiko.Prog, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetProgramByStartTime(ctx, stationID, start)
+}
+
+func (s *radikoSource) TimeshiftPlaylistM3U8(ctx context.Context, stationID string, start time.Time) (string, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return "", err
+	}
+	return client.TimeshiftPlaylistM3U8(ctx, stationID, start)
+}
+
+// LivePlaylistM3U8 returns the URL of the media playlist in the live master playlist.
+// The master playlist requires the auth token but the media playlist doesn't.
+func (s *radikoSource) LivePlaylistM3U8(ctx context.Context, stationID string) (string, error) {
+	client, err := s.radikoClient()
+	if err != nil {
+		return "", err
+	}
+	uri := fmt.Sprintf(livePlaylistURL, stationID)
+	playlist, err := fetchPlaylist(ctx, uri, http.Header{"X-Radiko-Authtoken": []string{client.AuthToken()}})
+	if err != nil {
+		return "", err
+	}
+	master, ok := playlist.(*m3u8.MasterPlaylist)
+	if !ok || len(master.Variants) == 0 || master.Variants[0] == nil {
+		return "", fmt.Errorf("invalid live playlist: stationID=%s", stationID)
+	}
+	base, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(master.Variants[0].URI)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *radikoSource) programExtras(ctx context.Context, stationID string, ft string) (*programExtras, error) {
+	return fetchProgramExtras(ctx, stationID, ft)
+}
@@ -0,0 +1,282 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/yyoshiki41/go-radiko"
+	bolt "go.etcd.io/bbolt"
+)
+
+type (
+	// store persists the index of the recordings, the jobs, the cached program guides, the recording failures
+	// and the tombstones of the deleted recordings.
+	// The recording directories remain the blob store of the audio files and the source to rebuild the store.
+	store interface {
+		putRecording(detail *RecordingDetail, status *Status) error
+		putStatus(stationID string, start time.Time, status *Status) error
+		deleteRecording(stationID string, start time.Time) error
+		// replaceRecordings replaces all the recordings.
+		replaceRecordings(recordings []storedRecording) error
+		recordings() ([]storedRecording, error)
+		putJob(job *Job) error
+		deleteJob(id string) error
+		// jobs returns the jobs in the order of creation.
+		jobs() ([]*Job, error)
+		putGuide(key string, guide *storedGuide) error
+		// guide returns nil if the guide is not cached.
+		guide(key string) (*storedGuide, error)
+		putFailure(stationID string, start time.Time, failure *programFailure) error
+		// failure returns nil if the program has not failed.
+		failure(stationID string, start time.Time) (*programFailure, error)
+		deleteFailure(stationID string, start time.Time) error
+		putTombstone(stationID string, start time.Time, tombstone *tombstone) error
+		// tombstone returns nil if the recording has not been deleted.
+		tombstone(stationID string, start time.Time) (*tombstone, error)
+		deleteTombstone(stationID string, start time.Time) error
+		close() error
+	}
+
+	storedRecording struct {
+		Detail *RecordingDetail `json:"detail"`
+		Status *Status          `json:"status"`
+	}
+
+	// storedGuide is the program guide cached in the store.
+	storedGuide struct {
+		Stations  radiko.Stations `json:"stations"`
+		FetchedAt time.Time       `json:"fetchedAt"`
+	}
+
+	// boltStore is the store backed by BoltDB.
+	boltStore struct {
+		db *bolt.DB
+	}
+)
+
+var (
+	recordingsBucket = []byte("recordings")
+	jobsBucket       = []byte("jobs")
+	guidesBucket     = []byte("guides")
+	failuresBucket   = []byte("failures")
+	tombstonesBucket = []byte("tombstones")
+)
+
+func openBoltStore(file string) (*boltStore, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{recordingsBucket, jobsBucket, guidesBucket, failuresBucket, tombstonesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+func (s *boltStore) putRecording(detail *RecordingDetail, status *Status) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(recordingsBucket), indexKey(detail.StationID, detail.Start), &storedRecording{detail, status})
+	})
+}
+
+func (s *boltStore) putStatus(stationID string, start time.Time, status *Status) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		key := indexKey(stationID, start)
+		v := b.Get([]byte(key))
+		if v == nil {
+			// the detail is not saved yet
+			return nil
+		}
+		var r storedRecording
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		r.Status = status
+		return putJSON(b, key, &r)
+	})
+}
+
+func (s *boltStore) deleteRecording(stationID string, start time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordingsBucket).Delete([]byte(indexKey(stationID, start)))
+	})
+}
+
+func (s *boltStore) replaceRecordings(recordings []storedRecording) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(recordingsBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(recordingsBucket)
+		if err != nil {
+			return err
+		}
+		for i := range recordings {
+			r := &recordings[i]
+			if err := putJSON(b, indexKey(r.Detail.StationID, r.Detail.Start), r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) recordings() ([]storedRecording, error) {
+	recordings := make([]storedRecording, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordingsBucket).ForEach(func(k, v []byte) error {
+			var r storedRecording
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			recordings = append(recordings, r)
+			return nil
+		})
+	})
+	return recordings, err
+}
+
+func (s *boltStore) putJob(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(jobsBucket), job.ID, job)
+	})
+}
+
+func (s *boltStore) deleteJob(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+func (s *boltStore) jobs() ([]*Job, error) {
+	jobs := make([]*Job, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, &job)
+			return nil
+		})
+	})
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, err
+}
+
+func (s *boltStore) putGuide(key string, guide *storedGuide) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(guidesBucket), key, guide)
+	})
+}
+
+func (s *boltStore) guide(key string) (*storedGuide, error) {
+	var guide *storedGuide
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(guidesBucket).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		guide = &storedGuide{}
+		return json.Unmarshal(v, guide)
+	})
+	return guide, err
+}
+
+func (s *boltStore) putFailure(stationID string, start time.Time, failure *programFailure) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(failuresBucket), indexKey(stationID, start), failure)
+	})
+}
+
+func (s *boltStore) failure(stationID string, start time.Time) (*programFailure, error) {
+	var failure *programFailure
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(failuresBucket).Get([]byte(indexKey(stationID, start)))
+		if v == nil {
+			return nil
+		}
+		failure = &programFailure{}
+		return json.Unmarshal(v, failure)
+	})
+	return failure, err
+}
+
+func (s *boltStore) deleteFailure(stationID string, start time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(failuresBucket).Delete([]byte(indexKey(stationID, start)))
+	})
+}
+
+func (s *boltStore) putTombstone(stationID string, start time.Time, tombstone *tombstone) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(tombstonesBucket), indexKey(stationID, start), tombstone)
+	})
+}
+
+func (s *boltStore) tombstone(stationID string, start time.Time) (*tombstone, error) {
+	var t *tombstone
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(tombstonesBucket).Get([]byte(indexKey(stationID, start)))
+		if v == nil {
+			return nil
+		}
+		t = &tombstone{}
+		return json.Unmarshal(v, t)
+	})
+	return t, err
+}
+
+func (s *boltStore) deleteTombstone(stationID string, start time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tombstonesBucket).Delete([]byte(indexKey(stationID, start)))
+	})
+}
+
+func (s *boltStore) close() error {
+	return s.db.Close()
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+// migrateJobsFile imports the jobs.json file used by the older version.
+func migrateJobsFile(s store, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var jobs []*Job
+	err = json.NewDecoder(f).Decode(&jobs)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := s.putJob(job); err != nil {
+			return err
+		}
+	}
+	return os.Rename(file, file+".migrated")
+}
@@ -0,0 +1,181 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+// taggedFormats are the formats which can hold the metadata tags.
+var taggedFormats = []string{FormatMP3, FormatM4A, FormatOpus, FormatFLAC}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// stationLogoURL returns the URL of the station logo image.
+func stationLogoURL(stationID string) string {
+	return fmt.Sprintf("https://radiko.jp/v2/static/station/logo/%s/224x100.png", stationID)
+}
+
+// metadata returns the tags of the recording.
+func (l *Library) metadata(detail *RecordingDetail, cover string) Metadata {
+	station := detail.StationName
+	if len(station) == 0 {
+		station = detail.StationID
+	}
+	artist := detail.Performer
+	if len(artist) == 0 {
+		artist = station
+	}
+	return Metadata{
+		Title:   detail.Title,
+		Artist:  artist,
+		Album:   station,
+		Date:    detail.Start.In(l.location).Format("2006-01-02"),
+		Comment: plainText(detail.Description),
+		Genre:   "Radio",
+		Cover:   cover,
+	}
+}
+
+// tag embeds the metadata tags and the cover art to the audio files of the recording.
+// Failures are logged and ignored because the audio files are still playable without tags.
+func (l *Library) tag(ctx context.Context, dir *recordingDirectory, formats ...string) {
+	detail, err := dir.loadDetail()
+	if err != nil {
+		log.Errorf("Failed to load recording detail for tagging: dir=%s, err=%v", dir.dir, err)
+		return
+	}
+	cover, err := l.cover(ctx, dir, detail)
+	if err != nil {
+		log.Warnf("Failed to get cover image: dir=%s, err=%v", dir.dir, err)
+	}
+	metadata := l.metadata(detail, cover)
+	for _, format := range formats {
+		if err := tagFile(ctx, dir.audioFile(format), metadata); err != nil {
+			log.Errorf("Failed to tag audio file: dir=%s, format=%s, err=%v", dir.dir, format, err)
+		}
+	}
+}
+
+// retag embeds the tags to all the existing audio files of the recording.
+func (l *Library) retag(ctx context.Context, dir *recordingDirectory) {
+	formats := make([]string, 0)
+	for _, format := range taggedFormats {
+		if _, err := os.Stat(dir.audioFile(format)); err == nil {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) > 0 {
+		l.tag(ctx, dir, formats...)
+	}
+}
+
+// cover returns the path of the cover image of the recording, downloading it if needed.
+// The program image is preferred to the station logo.
+func (l *Library) cover(ctx context.Context, dir *recordingDirectory, detail *RecordingDetail) (string, error) {
+	var lastErr error
+	for _, c := range []struct {
+		name string
+		url  string
+	}{
+		{"image", detail.Image},
+		{"logo", detail.StationLogo},
+		{"logo", stationLogoURL(detail.StationID)},
+	} {
+		if len(c.url) == 0 {
+			continue
+		}
+		file := filepath.Join(dir.dir, c.name+filepath.Ext(c.url))
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+		if err := downloadFile(ctx, c.url, file); err != nil {
+			lastErr = err
+			continue
+		}
+		return file, nil
+	}
+	return "", lastErr
+}
+
+// fillMetadata fills the station and the extra program metadata of the recording.
+// Failures are logged and ignored because the metadata is optional.
+func (l *Library) fillMetadata(ctx context.Context, detail *RecordingDetail) {
+	if len(detail.StationName) == 0 {
+		stations, err := l.source.GetStations(ctx, "", detail.Start)
+		if err != nil {
+			log.Warnf("Failed to get stations: %v", err)
+		}
+		for _, station := range stations {
+			if station.ID == detail.StationID {
+				detail.StationName = station.Name
+			}
+		}
+		detail.StationLogo = stationLogoURL(detail.StationID)
+	}
+	source, ok := l.source.(programExtrasSource)
+	if !ok {
+		return
+	}
+	if len(detail.Image) == 0 || len(detail.Genre) == 0 {
+		extras, err := source.programExtras(ctx, detail.StationID, l.FormatTime(detail.Start))
+		if err != nil {
+			log.Warnf("Failed to get program metadata: %v", err)
+			return
+		}
+		if len(detail.Performer) == 0 {
+			detail.Performer = extras.Pfm
+		}
+		detail.Image = extras.Img
+		detail.Genre = extras.Genre.Program.Name
+	}
+}
+
+// backfillDetail fills the metadata missing in the info.json of the recording recorded by the older version.
+func (l *Library) backfillDetail(ctx context.Context, dir *recordingDirectory) error {
+	detail, err := dir.loadDetail()
+	if err != nil {
+		return err
+	}
+	if len(detail.StationName) > 0 && len(detail.Image) > 0 {
+		return nil
+	}
+	l.fillMetadata(ctx, detail)
+	if err := dir.saveDetail(detail); err != nil {
+		return err
+	}
+	status, err := dir.loadStatus()
+	if err != nil {
+		return err
+	}
+	if err := l.store.putRecording(detail, status); err != nil {
+		return err
+	}
+	l.index.put(detail, status.Status)
+	return nil
+}
+
+// tagFile rewrites the audio file with the metadata.
+func tagFile(ctx context.Context, file string, metadata Metadata) error {
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	ext := filepath.Ext(file)
+	tmp := strings.TrimSuffix(file, ext) + ".tagging" + ext
+	if err := produce(tmp, func(output string) error {
+		return TagAudioFile(ctx, file, output, metadata)
+	}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// plainText removes the html tags from the program description.
+func plainText(s string) string {
+	return strings.TrimSpace(htmlTagPattern.ReplaceAllString(s, ""))
+}
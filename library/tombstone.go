@@ -0,0 +1,37 @@
+package library
+
+import (
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	DeletedByUser      = "USER"
+	DeletedByRetention = "RETENTION"
+)
+
+// tombstone marks the program whose recording has been deleted.
+// The scans skip the program so that the deleted recording is not recorded again while it is in the weekly guide.
+// Recording the program by hand clears the tombstone.
+type tombstone struct {
+	DeletedAt time.Time `json:"deletedAt"`
+	// Reason is one of DeletedBy*.
+	Reason string `json:"reason"`
+}
+
+// deleted returns true if the recording of the program has been deleted.
+func (l *Library) deleted(stationID string, start time.Time) (bool, error) {
+	t, err := l.store.tombstone(stationID, start)
+	if err != nil {
+		return false, err
+	}
+	return t != nil, nil
+}
+
+// undelete clears the tombstone of the program to record it again.
+func (l *Library) undelete(stationID string, start time.Time) {
+	if err := l.store.deleteTombstone(stationID, start); err != nil {
+		log.Warnf("Failed to clear the tombstone: stationID=%s, start=%s, err=%v", stationID, start, err)
+	}
+}
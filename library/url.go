@@ -0,0 +1,115 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// ErrUnsupportedURL is wrapped by URLError.
+var ErrUnsupportedURL = errors.New("unsupported program url")
+
+// SupportedURLFormats are the formats of the radiko.jp URLs accepted by ParseProgramURL.
+var SupportedURLFormats = []string{
+	"https://radiko.jp/#!/ts/<stationID>/<20060102150405>",
+	"https://radiko.jp/share/?sid=<stationID>&t=<20060102150405>",
+}
+
+var (
+	stationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	datetimePattern  = regexp.MustCompile(`^\d{14}$`)
+)
+
+// URLError is the error for the URL which doesn't point a timeshift program of radiko.jp.
+type URLError struct {
+	URL    string
+	Reason string
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrUnsupportedURL, e.Reason, e.URL)
+}
+
+func (e *URLError) Unwrap() error {
+	return ErrUnsupportedURL
+}
+
+// ParseProgramURL returns the station and the start time of the program from the radiko.jp timeshift or share URL.
+// Share links point the playback position, so the time is adjusted to the start of the program containing it if the program is in the weekly guide.
+func (l *Library) ParseProgramURL(rawURL string) (string, time.Time, error) {
+	stationID, t, err := parseProgramURL(rawURL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	start, err := l.ParseTime(t)
+	if err != nil {
+		return "", time.Time{}, &URLError{rawURL, "invalid time"}
+	}
+	return stationID, l.programStart(stationID, start), nil
+}
+
+func parseProgramURL(rawURL string) (stationID string, t string, err error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", "", &URLError{rawURL, "malformed url"}
+	}
+	if host := strings.TrimPrefix(u.Hostname(), "www."); host != "radiko.jp" {
+		return "", "", &URLError{rawURL, "not a radiko.jp url"}
+	}
+	switch {
+	case strings.HasPrefix(u.Fragment, "!/ts/"):
+		// https://radiko.jp/#!/ts/TBS/20201231230000
+		fragment := u.Fragment
+		if i := strings.IndexAny(fragment, "?&"); i >= 0 {
+			fragment = fragment[:i]
+		}
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(fragment, "!/ts/"), "/"), "/")
+		if len(parts) != 2 {
+			return "", "", &URLError{rawURL, "station and time are required"}
+		}
+		stationID, t = parts[0], parts[1]
+	case len(u.Query().Get("sid")) > 0 || len(u.Query().Get("t")) > 0:
+		// https://radiko.jp/share/?sid=TBS&t=20201231230000
+		stationID, t = u.Query().Get("sid"), u.Query().Get("t")
+	default:
+		return "", "", &URLError{rawURL, "not a timeshift url"}
+	}
+	if !stationIDPattern.MatchString(stationID) {
+		return "", "", &URLError{rawURL, "invalid station"}
+	}
+	if !datetimePattern.MatchString(t) {
+		return "", "", &URLError{rawURL, "invalid time"}
+	}
+	return stationID, t, nil
+}
+
+// programStart returns the start time of the program on air at t.
+// t is returned as is if the program is not found in the weekly guide.
+func (l *Library) programStart(stationID string, t time.Time) time.Time {
+	guide, err := l.guides.weekly(l.ctx, stationID)
+	if err != nil {
+		log.Warnf("Failed to get weekly programs: stationID=%s, err=%v", stationID, err)
+		return t
+	}
+	for _, station := range guide {
+		for _, prog := range station.Progs.Progs {
+			start, err := l.ParseTime(prog.Ft)
+			if err != nil {
+				continue
+			}
+			end, err := l.ParseTime(prog.To)
+			if err != nil {
+				continue
+			}
+			if !t.Before(start) && t.Before(end) {
+				return start
+			}
+		}
+	}
+	return t
+}
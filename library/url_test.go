@@ -0,0 +1,72 @@
+package library
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProgramURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		stationID string
+		t         string
+	}{
+		// timeshift urls
+		{"https://radiko.jp/#!/ts/TBS/20201231230000", "TBS", "20201231230000"},
+		{"http://radiko.jp/#!/ts/TBS/20201231230000", "TBS", "20201231230000"},
+		{"https://www.radiko.jp/#!/ts/LFR/20201231250000/", "LFR", "20201231250000"},
+		{"https://radiko.jp/#!/ts/FMJ/20201231230000?noreload=1", "FMJ", "20201231230000"},
+		{"https://radiko.jp/#!/ts/ABC-RADIO/20201231230000&share", "ABC-RADIO", "20201231230000"},
+		{"  https://radiko.jp/#!/ts/TBS/20201231230000\n", "TBS", "20201231230000"},
+		// share links
+		{"https://radiko.jp/share/?sid=TBS&t=20201231231530", "TBS", "20201231231530"},
+		{"https://www.radiko.jp/share/?t=20201231231530&sid=QRR", "QRR", "20201231231530"},
+		{"https://radiko.jp/share/?sid=TBS&t=20201231231530#!/ts/LFR/20201231230000", "LFR", "20201231230000"},
+	}
+	for _, tt := range tests {
+		stationID, ts, err := parseProgramURL(tt.url)
+		if err != nil {
+			t.Errorf("parseProgramURL(%q): %v", tt.url, err)
+			continue
+		}
+		if stationID != tt.stationID || ts != tt.t {
+			t.Errorf("parseProgramURL(%q) = %s, %s, want %s, %s", tt.url, stationID, ts, tt.stationID, tt.t)
+		}
+	}
+}
+
+func TestParseProgramURLError(t *testing.T) {
+	tests := []struct {
+		url    string
+		reason string
+	}{
+		{"https://radiko.jp/%zz", "malformed url"},
+		{"https://example.com/#!/ts/TBS/20201231230000", "not a radiko.jp url"},
+		{"https://radiko.jp.example.com/share/?sid=TBS&t=20201231230000", "not a radiko.jp url"},
+		{"radiko.jp/#!/ts/TBS/20201231230000", "not a radiko.jp url"},
+		{"https://radiko.jp/#!/live/TBS", "not a timeshift url"},
+		{"https://radiko.jp/", "not a timeshift url"},
+		{"https://radiko.jp/#!/ts/TBS", "station and time are required"},
+		{"https://radiko.jp/#!/ts/TBS/20201231/230000", "station and time are required"},
+		{"https://radiko.jp/#!/ts/../20201231230000", "invalid station"},
+		{"https://radiko.jp/share/?t=20201231230000", "invalid station"},
+		{"https://radiko.jp/share/?sid=TBS%2F..&t=20201231230000", "invalid station"},
+		{"https://radiko.jp/#!/ts/TBS/202012312300", "invalid time"},
+		{"https://radiko.jp/share/?sid=TBS", "invalid time"},
+		{"https://radiko.jp/share/?sid=TBS&t=2020-12-31T23:00", "invalid time"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseProgramURL(tt.url)
+		var urlErr *URLError
+		if !errors.As(err, &urlErr) {
+			t.Errorf("parseProgramURL(%q): err = %v, want URLError", tt.url, err)
+			continue
+		}
+		if urlErr.Reason != tt.reason {
+			t.Errorf("parseProgramURL(%q): reason = %q, want %q", tt.url, urlErr.Reason, tt.reason)
+		}
+		if !errors.Is(err, ErrUnsupportedURL) {
+			t.Errorf("parseProgramURL(%q): err doesn't wrap ErrUnsupportedURL", tt.url)
+		}
+	}
+}
@@ -30,6 +30,26 @@ var (
 	relativePath string
 	port         int
 	migrate      bool
+	rebuild      bool
+	// retention policy, zero disables the limit
+	retentionKeep    int
+	retentionMaxAge  time.Duration
+	retentionMaxSize int64
+	// default output profile of the recordings
+	outputKeepChunks   bool
+	outputAACContainer string
+	outputMP3          bool
+	outputMP3Bitrate   int
+	outputOpus         bool
+	outputOpusBitrate  int
+	outputFLAC         bool
+	// interval to refresh the cached program guides
+	guideRefresh time.Duration
+	// cron schedules to scan the programs separated by ';'
+	scanSchedules string
+	recordDelay   time.Duration
+	// area IDs to scan in addition to the detected area separated by ','
+	areas string
 )
 
 func main() {
@@ -39,6 +59,21 @@ func main() {
 	flag.StringVar(&relativePath, "rel", "", "")
 	flag.IntVar(&port, "port", 8080, "")
 	flag.BoolVar(&migrate, "migrate", false, "")
+	flag.BoolVar(&rebuild, "rebuild", false, "rebuild the library database from the data directory")
+	flag.IntVar(&retentionKeep, "retention-keep", 0, "number of the latest episodes to keep per keyword")
+	flag.DurationVar(&retentionMaxAge, "retention-max-age", 0, "maximum age of the recordings. e.g. 720h")
+	flag.Int64Var(&retentionMaxSize, "retention-max-size", 0, "maximum total size of the recordings in MB")
+	flag.BoolVar(&outputKeepChunks, "output-keep-chunks", true, "keep the chunk files for the m3u8 playlist")
+	flag.StringVar(&outputAACContainer, "output-aac", library.AACContainerADTS, "container of the aac file. adts/m4a/none")
+	flag.BoolVar(&outputMP3, "output-mp3", true, "produce the mp3 file")
+	flag.IntVar(&outputMP3Bitrate, "output-mp3-bitrate", 0, "bitrate of the mp3 file in kbps. 0 means VBR")
+	flag.BoolVar(&outputOpus, "output-opus", false, "produce the opus file")
+	flag.IntVar(&outputOpusBitrate, "output-opus-bitrate", 0, "bitrate of the opus file in kbps. 0 means 64kbps")
+	flag.BoolVar(&outputFLAC, "output-flac", false, "produce the flac file")
+	flag.DurationVar(&guideRefresh, "guide-refresh", library.DefaultGuideRefreshInterval, "interval to refresh the cached program guides")
+	flag.StringVar(&scanSchedules, "scan", library.DefaultScanSchedule, "cron schedules to scan the programs separated by ';'")
+	flag.DurationVar(&recordDelay, "record-delay", library.DefaultRecordDelay, "delay from the program end to the recording")
+	flag.StringVar(&areas, "areas", "", "area IDs to scan in addition to the detected area separated by ','. e.g. JP13,JP27")
 	flag.Parse()
 
 	if len(relativePath) != 0 {
@@ -62,7 +97,42 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer l.Close()
 
+	if rebuild {
+		if err := l.Rebuild(); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := l.SetOutputProfile(library.OutputProfile{
+		KeepChunks:   outputKeepChunks,
+		AACContainer: outputAACContainer,
+		MP3:          outputMP3,
+		MP3Bitrate:   outputMP3Bitrate,
+		Opus:         outputOpus,
+		OpusBitrate:  outputOpusBitrate,
+		FLAC:         outputFLAC,
+	}); err != nil {
+		panic(err)
+	}
+
+	l.SetRetention(library.Retention{
+		KeepPerKeyword: retentionKeep,
+		MaxAge:         retentionMaxAge,
+		MaxTotalSize:   retentionMaxSize * 1024 * 1024,
+	})
+	l.SetGuideRefreshInterval(guideRefresh)
+
+	if err := l.SetAreas(splitList(areas, ",")); err != nil {
+		panic(err)
+	}
+	if err := l.SetScanSchedules(splitList(scanSchedules, ";")); err != nil {
+		panic(err)
+	}
+	l.SetRecordDelay(recordDelay)
+
+	// the configuration is applied before the workers are started by the load
 	if err := l.Load(); err != nil {
 		panic(err)
 	}
@@ -73,13 +143,13 @@ func main() {
 		}
 	}
 
+	l.StartScheduler()
+
 	go func() {
 		for {
-			log.Infof("Scanning programs for recording...")
-			if err := l.ScanAndRecord(); err != nil {
-				log.Errorf("Failed to record: %v", err)
-			} else {
-				log.Infof("Successfully scan programs for recording.")
+			log.Infof("Sweeping recordings by retention policy...")
+			if err := l.Sweep(); err != nil {
+				log.Errorf("Failed to sweep: %v", err)
 			}
 			time.Sleep(time.Hour)
 		}
@@ -91,14 +161,38 @@ func main() {
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		// the browsers hide the pagination header from the scripts without this
+		ExposeHeaders: []string{"X-Next-Cursor"},
+	}))
 
 	// Routes
 	e.POST(relativePath+"/recordings/record", a.Record)
 	e.GET(relativePath+"/recordings/", a.List)
 	e.GET(relativePath+"/recordings/recording/:stationID/:start", a.Get)
+	e.DELETE(relativePath+"/recordings/recording/:stationID/:start", a.Delete)
+	e.PUT(relativePath+"/recordings/recording/:stationID/:start/pin", a.Pin)
+	e.DELETE(relativePath+"/recordings/recording/:stationID/:start/pin", a.Unpin)
 	e.GET(relativePath+"/recordings/recording/:stationID/:start/audio", a.Audio)
 	e.GET(relativePath+"/recordings/recording/:stationID/:start/:file", a.File)
+	e.GET(relativePath+"/feeds/keywords/:id", a.KeywordFeed)
+	e.GET(relativePath+"/feeds/stations/:stationID", a.StationFeed)
+	e.GET(relativePath+"/jobs", a.Jobs)
+	e.GET(relativePath+"/jobs/:id", a.Job)
+	e.POST(relativePath+"/jobs/:id/cancel", a.CancelJob)
+	e.POST(relativePath+"/jobs/:id/retry", a.RetryJob)
+	e.GET(relativePath+"/scheduler", a.Scheduler)
+	e.GET(relativePath+"/scheduler/report", a.ScanReport)
+	e.POST(relativePath+"/scheduler/scan", a.Scan)
+	e.GET(relativePath+"/area", a.Area)
+	e.GET(relativePath+"/stations", a.Stations)
+	e.GET(relativePath+"/stations/:id/programs", a.Programs)
+	e.GET(relativePath+"/keywords", a.Keywords)
+	e.POST(relativePath+"/keywords", a.RegisterKeyword)
+	e.GET(relativePath+"/keywords/preview", a.PreviewKeywords)
+	e.GET(relativePath+"/keywords/:id/preview", a.PreviewKeyword)
+	e.PUT(relativePath+"/keywords/:id", a.UpdateKeyword)
+	e.DELETE(relativePath+"/keywords/:id", a.UnregisterKeyword)
 	if len(relativePath) == 0 {
 		e.Static("/", staticDir)
 	} else {
@@ -123,3 +217,14 @@ func updateStaticBase() error {
 	replaced := r.ReplaceAll(b, []byte(fmt.Sprintf(`<base href="%s">`, rel)))
 	return ioutil.WriteFile(indexFile, replaced, 0777)
 }
+
+// splitList splits the list separated by sep, e.g. the cron schedules separated by ';'.
+func splitList(s string, sep string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, sep) {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}